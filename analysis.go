@@ -0,0 +1,121 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"context"
+	"time"
+)
+
+// Analysis contains the results of analyzing a document, as returned by
+// Analyze. The analysis is performed on a private copy of the document, so
+// the document itself is not modified and can be analyzed again, or
+// concurrently by multiple goroutines.
+type Analysis struct {
+	doc Document
+
+	duration    time.Duration // Total time taken by the analysis.
+	preparation time.Duration // Time taken to prepare objects.
+	evaluation  time.Duration // Time taken to evaluate tests.
+}
+
+// Analyze analyzes document d on the host system using the default engine. See
+// Engine.Analyze for details.
+func Analyze(ctx context.Context, d Document) (*Analysis, error) {
+	return defaultEngine.Analyze(ctx, d)
+}
+
+// Analyze analyzes document d on the host system, preparing and executing all
+// tests in the document, and returns an Analysis containing the results. The
+// document is not modified.
+//
+// Preparation of objects is abandoned if ctx is cancelled or the document time
+// budget of the engine expires, and tests that reference objects which could
+// not be prepared in time are marked with ErrTimeout. If ctx itself is
+// cancelled, the error from ctx is returned along with the analysis.
+func (e *Engine) Analyze(ctx context.Context, d Document) (*Analysis, error) {
+	a := &Analysis{doc: d.clone()}
+	a.doc.engine = e
+	a.doc.analyzed = true
+	a.doc.fsIndex = newFileIndex(&a.doc)
+	a.doc.pkgCache = &packageCache{}
+	dctx := ctx
+	if e.documentTimeout > 0 {
+		var cancel context.CancelFunc
+		dctx, cancel = context.WithTimeout(ctx, e.documentTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	e.debugPrint("preparing objects...\n")
+	err := a.doc.prepareObjects(dctx)
+	if err != nil {
+		return nil, err
+	}
+	a.preparation = time.Since(start)
+	e.debugPrint("analyzing document...\n")
+	err = a.doc.runTests()
+	if err != nil {
+		return nil, err
+	}
+	a.duration = time.Since(start)
+	a.evaluation = a.duration - a.preparation
+	return a, ctx.Err()
+}
+
+// GetResults returns the results for the test with identifier testid.
+func (a *Analysis) GetResults(testid string) (TestResult, error) {
+	return GetResults(&a.doc, testid)
+}
+
+// GetTestIdentifiers returns the test identifiers for all tests present in
+// the analyzed document.
+func (a *Analysis) GetTestIdentifiers() []string {
+	return a.doc.GetTestIdentifiers()
+}
+
+// Results returns the results for all tests in the analyzed document, in the
+// order the tests appear in the document.
+func (a *Analysis) Results() []TestResult {
+	ret := make([]TestResult, 0)
+	for _, x := range a.doc.GetTestIdentifiers() {
+		tr, err := GetResults(&a.doc, x)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, tr)
+	}
+	return ret
+}
+
+// Summary returns a summary of the cost of the analysis, including the timing
+// of each object and test in the order they appear in the document.
+func (a *Analysis) Summary() AnalysisSummary {
+	ret := AnalysisSummary{
+		Duration:    a.duration,
+		Preparation: a.preparation,
+		Evaluation:  a.evaluation,
+		Objects:     make([]ObjectTiming, 0),
+		Tests:       make([]TestTiming, 0),
+	}
+	st := a.doc.fsIndex.getStats()
+	ret.Walks = st.walks
+	ret.FilesWalked = st.filesWalked
+	ret.FilesRead = st.filesRead
+	ret.FileCacheHits = st.cacheHits
+	for i := range a.doc.Objects {
+		ot := a.doc.Objects[i].timing()
+		if ot.PackageCache > ret.PackageCache {
+			ret.PackageCache = ot.PackageCache
+		}
+		ret.Objects = append(ret.Objects, ot)
+	}
+	for i := range a.doc.Tests {
+		ret.Tests = append(ret.Tests, a.doc.Tests[i].timing(&a.doc))
+	}
+	return ret
+}
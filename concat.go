@@ -10,17 +10,24 @@ package scribe
 // This function does criteria concatenation based on identifier. Where
 // criteria is found with a matching identifier, the results are
 // concatenated together. Since the slice is ordered based on expression
-// groups there should not be any ordering issues.
-func criteriaConcat(in []evaluationCriteria, concat string) []evaluationCriteria {
+// groups there should not be any ordering issues. The results are returned
+// in the order each identifier was first seen, so result ordering remains
+// deterministic.
+func criteriaConcat(d *Document, in []evaluationCriteria, concat string) []evaluationCriteria {
 	ret := make([]evaluationCriteria, 0)
 	if len(in) == 0 {
 		return ret
 	}
-	debugPrint("criteriaConcat(): applying concat with \"%v\" on identifier\n", concat)
+	d.debugPrint("criteriaConcat(): applying concat with \"%v\" on identifier\n", concat)
 	retmap := make(map[string]evaluationCriteria, 0)
+	order := make([]string, 0)
 	for _, x := range in {
-		nr := evaluationCriteria{identifier: x.identifier}
+		if _, ok := retmap[x.identifier]; ok {
+			continue
+		}
+		nr := evaluationCriteria{identifier: x.identifier, line: x.line}
 		retmap[x.identifier] = nr
+		order = append(order, x.identifier)
 	}
 	for _, x := range in {
 		retent := retmap[x.identifier]
@@ -31,8 +38,9 @@ func criteriaConcat(in []evaluationCriteria, concat string) []evaluationCriteria
 		}
 		retmap[x.identifier] = retent
 	}
-	for _, x := range retmap {
-		debugPrint("criteriaConcat(): result \"%v\", \"%v\"\n", x.identifier, x.testValue)
+	for _, y := range order {
+		x := retmap[y]
+		d.debugPrint("criteriaConcat(): result \"%v\", \"%v\"\n", x.identifier, x.testValue)
 		ret = append(ret, x)
 	}
 	return ret
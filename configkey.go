@@ -0,0 +1,409 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// The maximum size of a file that will be parsed by a ConfigKey object.
+const configKeyMaxSize = 16 * 1024 * 1024
+
+// ConfigKey is used to perform tests against values in structured
+// configuration files, such as JSON, YAML, TOML or INI files. Locator options
+// can be included to control how the file system is searched.
+//
+// Format is the format of the located files, and must be one of json, yaml,
+// toml or ini. Files that can not be parsed in the format are reported as
+// warnings.
+//
+// Key is a path expression selecting the values to return. The expression is
+// a series of keys separated by dots, for example "log-opts.max-size", and may
+// optionally begin with "$.". A key containing dots or other special
+// characters can be quoted ("a.\"b.c\".d") or written in brackets
+// (a["b.c"].d). Elements of a list are selected with an index (a.b[0]), and
+// * selects every key of a map or every element of a list (a.*.c or a[*]).
+// For ini files, keys that are not in a section are at the top level and
+// section keys are selected using the section name, for example
+// "sssd.services" or "\"domain/example.com\".id_provider".
+//
+// A candidate is returned for each value the expression selects in each file.
+// Files that do not contain the key produce no candidates. If Exists is true,
+// instead of the values a single candidate is returned for each file, which is
+// true if the key was present in the file and false if it was absent.
+//
+// Values are returned as the parser for the format interprets them, rather
+// than as they are written in the file, as follows.
+//
+//	strings      returned unchanged
+//	booleans     true or false
+//	integers     in decimal, so TOML 0xff is returned as 255
+//	floats       in decimal without an exponent, using the fewest digits
+//	             needed, so TOML 1000000.0 and 1e6 are both returned as
+//	             1000000; infinity and NaN are returned as +Inf, -Inf and NaN
+//	JSON numbers exactly as they appear in the file
+//	TOML dates   in RFC 3339 form with a T separator, for example
+//	and times    1979-05-27T07:32:00Z, or 1979-05-27 for a local date
+//	null         null
+//	maps, lists  encoded as JSON
+//
+// YAML files are interpreted using YAML 1.1, in which the unquoted words yes,
+// no, on, off, y and n are booleans, and an integer with a leading 0 is octal;
+// for example "mode: 0640" is returned as 416, and "enabled: on" as true.
+// Quoted YAML values are strings and are returned unchanged.
+type ConfigKey struct {
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+	File   string `json:"file,omitempty" yaml:"file,omitempty"`
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	Key    string `json:"key,omitempty" yaml:"key,omitempty"`
+	Exists bool   `json:"exists,omitempty" yaml:"exists,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	matches []configMatch
+}
+
+type configMatch struct {
+	path  string
+	value string
+}
+
+// configPathElem is an element of a parsed ConfigKey path expression.
+type configPathElem struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func (c *ConfigKey) isChain() bool {
+	return false
+}
+
+func (c *ConfigKey) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (c *ConfigKey) mergeCriteria(cr []evaluationCriteria) {
+}
+
+func (c *ConfigKey) validate(d *Document) error {
+	if len(c.Path) == 0 {
+		return fmt.Errorf("configkey path must be set")
+	}
+	if len(c.File) == 0 {
+		return fmt.Errorf("configkey file must be set")
+	}
+	_, err := regexp.Compile(c.File)
+	if err != nil {
+		return err
+	}
+	switch c.Format {
+	case "json", "yaml", "toml", "ini":
+	case "":
+		return fmt.Errorf("configkey format must be set")
+	default:
+		return fmt.Errorf("configkey format %v is not valid", c.Format)
+	}
+	if len(c.Key) == 0 {
+		return fmt.Errorf("configkey key must be set")
+	}
+	_, err = parseConfigPath(c.Key)
+	if err != nil {
+		return fmt.Errorf("configkey key: %v", err)
+	}
+	return c.LocatorOptions.validate()
+}
+
+func (c *ConfigKey) expandVariables(d *Document, v []Variable) {
+	c.Path = variableExpansion(d, v, c.Path)
+	c.File = variableExpansion(d, v, c.File)
+}
+
+func (c *ConfigKey) getCriteria(d *Document) (ret []evaluationCriteria) {
+	for _, x := range c.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (c *ConfigKey) prepare(ctx context.Context, d *Document) error {
+	d.debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", c.Path, c.File)
+
+	cpath, err := parseConfigPath(c.Key)
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator(d)
+	sfl.root = c.Path
+	err = sfl.setOptions(c.LocatorOptions)
+	if err != nil {
+		return err
+	}
+	err = sfl.locate(ctx, c.File, true)
+	if err != nil {
+		return err
+	}
+	d.addWarnings(sfl.warnings)
+
+	for _, x := range sfl.matches {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		root, err := c.parseFile(d, x)
+		if err != nil {
+			d.warn(x, err)
+			continue
+		}
+		values := configLookup(root, cpath)
+		d.debugPrint("prepare(): %v has %v values for key \"%v\"\n", x, len(values), c.Key)
+		if c.Exists {
+			c.matches = append(c.matches, configMatch{path: x,
+				value: strconv.FormatBool(len(values) > 0)})
+			continue
+		}
+		for _, y := range values {
+			v, err := configValueString(y)
+			if err != nil {
+				d.warn(x, err)
+				continue
+			}
+			c.matches = append(c.matches, configMatch{path: x, value: v})
+		}
+	}
+
+	return nil
+}
+
+// parseFile reads and parses the file at path in the format of the object.
+func (c *ConfigKey) parseFile(d *Document, path string) (interface{}, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > configKeyMaxSize {
+		return nil, fmt.Errorf("file size %v exceeds configkey maximum size %v", fi.Size(), configKeyMaxSize)
+	}
+	if d.object != nil {
+		d.object.stats.filesRead++
+	}
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	switch c.Format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		// Keep numbers as they appear in the file, rather than
+		// converting them to floating point.
+		dec.UseNumber()
+		err = dec.Decode(&ret)
+	case "yaml":
+		err = yaml.Unmarshal(buf, &ret)
+		if err == nil {
+			ret, err = normalizeYAML(ret)
+		}
+	case "toml":
+		var m map[string]interface{}
+		err = toml.Unmarshal(buf, &m)
+		ret = m
+	case "ini":
+		ret, err = parseINI(string(buf))
+	default:
+		err = fmt.Errorf("configkey format %v is not valid", c.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %v: %v", c.Format, err)
+	}
+	return ret, nil
+}
+
+// normalizeYAML converts maps decoded by the yaml package, which can have
+// keys of any type, into maps with string keys so they can be handled the
+// same way as the other formats.
+func normalizeYAML(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{})
+		for k, x := range t {
+			nv, err := normalizeYAML(x)
+			if err != nil {
+				return nil, err
+			}
+			ret[fmt.Sprint(k)] = nv
+		}
+		return ret, nil
+	case []interface{}:
+		ret := make([]interface{}, 0, len(t))
+		for _, x := range t {
+			nv, err := normalizeYAML(x)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, nv)
+		}
+		return ret, nil
+	}
+	return v, nil
+}
+
+// configValueString converts a value selected from a configuration file into
+// the string used as a candidate value, as described for ConfigKey.
+func configValueString(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case json.Number:
+		return t.String(), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case time.Time:
+		return t.Format(time.RFC3339Nano), nil
+	case map[string]interface{}, []interface{}:
+		buf, err := json.Marshal(t)
+		if err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// parseConfigPath parses a ConfigKey path expression.
+func parseConfigPath(s string) ([]configPathElem, error) {
+	ret := make([]configPathElem, 0)
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+		if strings.HasPrefix(s, ".") {
+			s = s[1:]
+		}
+	}
+	if s == "" {
+		return nil, fmt.Errorf("empty path expression")
+	}
+	i := 0
+	for {
+		// Each element begins with a key, unless it is only made up
+		// of brackets.
+		if s[i] != '[' {
+			var elem configPathElem
+			switch s[i] {
+			case '"', '\'':
+				end := strings.IndexByte(s[i+1:], s[i])
+				if end == -1 {
+					return nil, fmt.Errorf("unterminated quote in path expression")
+				}
+				elem.key = s[i+1 : i+1+end]
+				i += end + 2
+			default:
+				end := strings.IndexAny(s[i:], ".[")
+				if end == -1 {
+					end = len(s) - i
+				}
+				elem.key = s[i : i+end]
+				if elem.key == "" {
+					return nil, fmt.Errorf("empty key in path expression")
+				}
+				if elem.key == "*" {
+					elem.wildcard = true
+				}
+				i += end
+			}
+			ret = append(ret, elem)
+		}
+		for i < len(s) && s[i] == '[' {
+			end := strings.IndexByte(s[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated bracket in path expression")
+			}
+			content := s[i+1 : i+end]
+			i += end + 1
+			var elem configPathElem
+			switch {
+			case content == "*":
+				elem.wildcard = true
+			case len(content) >= 2 && (content[0] == '"' || content[0] == '\'') &&
+				content[len(content)-1] == content[0]:
+				elem.key = content[1 : len(content)-1]
+			default:
+				n, err := strconv.Atoi(content)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid index \"%v\" in path expression", content)
+				}
+				elem.index = n
+				elem.isIndex = true
+			}
+			ret = append(ret, elem)
+		}
+		if i >= len(s) {
+			break
+		}
+		if s[i] != '.' || i+1 >= len(s) {
+			return nil, fmt.Errorf("unexpected \"%v\" in path expression", s[i:])
+		}
+		i++
+	}
+	return ret, nil
+}
+
+// configLookup returns all values in v selected by path.
+func configLookup(v interface{}, path []configPathElem) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	ret := make([]interface{}, 0)
+	e := path[0]
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if e.wildcard {
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				ret = append(ret, configLookup(t[k], path[1:])...)
+			}
+		} else if !e.isIndex {
+			if x, ok := t[e.key]; ok {
+				ret = append(ret, configLookup(x, path[1:])...)
+			}
+		}
+	case []interface{}:
+		if e.wildcard {
+			for _, x := range t {
+				ret = append(ret, configLookup(x, path[1:])...)
+			}
+		} else if e.isIndex && e.index < len(t) {
+			ret = append(ret, configLookup(t[e.index], path[1:])...)
+		}
+	}
+	return ret
+}
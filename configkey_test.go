@@ -0,0 +1,509 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestConfigKeyPolicy
+var configKeyPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/configkey" }
+	],
+
+	"objects": [
+	{
+		"object": "docker-icc",
+		"configkey": {
+			"path": "${root}",
+			"file": "^daemon\\.json$",
+			"format": "json",
+			"key": "icc"
+		}
+	},
+
+	{
+		"object": "docker-log-max-size",
+		"configkey": {
+			"path": "${root}",
+			"file": "^daemon\\.json$",
+			"format": "json",
+			"key": "log-opts.max-size"
+		}
+	},
+
+	{
+		"object": "docker-log-max-file",
+		"configkey": {
+			"path": "${root}",
+			"file": "^daemon\\.json$",
+			"format": "json",
+			"key": "$[\"log-opts\"][\"max-file\"]"
+		}
+	},
+
+	{
+		"object": "docker-nofile-hard",
+		"configkey": {
+			"path": "${root}",
+			"file": "^daemon\\.json$",
+			"format": "json",
+			"key": "default-ulimits.nofile.Hard"
+		}
+	},
+
+	{
+		"object": "docker-authz-plugins",
+		"configkey": {
+			"path": "${root}",
+			"file": "^daemon\\.json$",
+			"format": "json",
+			"key": "authorization-plugins",
+			"exists": true
+		}
+	},
+
+	{
+		"object": "docker-registries",
+		"configkey": {
+			"path": "${root}",
+			"file": "^daemon\\.json$",
+			"format": "json",
+			"key": "insecure-registries"
+		}
+	},
+
+	{
+		"object": "kubelet-anonymous",
+		"configkey": {
+			"path": "${root}",
+			"file": "^kubelet\\.yaml$",
+			"format": "yaml",
+			"key": "authentication.anonymous.enabled"
+		}
+	},
+
+	{
+		"object": "kubelet-readonly-port",
+		"configkey": {
+			"path": "${root}",
+			"file": "^kubelet\\.yaml$",
+			"format": "yaml",
+			"key": "readOnlyPort"
+		}
+	},
+
+	{
+		"object": "kubelet-ciphers",
+		"configkey": {
+			"path": "${root}",
+			"file": "^kubelet\\.yaml$",
+			"format": "yaml",
+			"key": "tlsCipherSuites[*]"
+		}
+	},
+
+	{
+		"object": "containerd-selinux",
+		"configkey": {
+			"path": "${root}",
+			"file": "^config\\.toml$",
+			"format": "toml",
+			"key": "plugins.\"io.containerd.grpc.v1.cri\".enable_selinux"
+		}
+	},
+
+	{
+		"object": "containerd-grpc-size",
+		"configkey": {
+			"path": "${root}",
+			"file": "^config\\.toml$",
+			"format": "toml",
+			"key": "grpc.max_recv_message_size"
+		}
+	},
+
+	{
+		"object": "containerd-systemd-cgroup",
+		"configkey": {
+			"path": "${root}",
+			"file": "^config\\.toml$",
+			"format": "toml",
+			"key": "plugins.*.containerd.runtimes.runc.options.SystemdCgroup"
+		}
+	},
+
+	{
+		"object": "containerd-snapshotters",
+		"configkey": {
+			"path": "${root}",
+			"file": "^config\\.toml$",
+			"format": "toml",
+			"key": "plugins[\"io.containerd.grpc.v1.cri\"].disabled_snapshotters"
+		}
+	},
+
+	{
+		"object": "containerd-proxy-names",
+		"configkey": {
+			"path": "${root}",
+			"file": "^config\\.toml$",
+			"format": "toml",
+			"key": "proxy_plugins[*].name"
+		}
+	},
+
+	{
+		"object": "containerd-proxy-description",
+		"configkey": {
+			"path": "${root}",
+			"file": "^config\\.toml$",
+			"format": "toml",
+			"key": "proxy_plugins[1].description"
+		}
+	},
+
+	{
+		"object": "containerd-proxy-started",
+		"configkey": {
+			"path": "${root}",
+			"file": "^config\\.toml$",
+			"format": "toml",
+			"key": "proxy_plugins[0].started"
+		}
+	},
+
+	{
+		"object": "sssd-reqcert",
+		"configkey": {
+			"path": "${root}",
+			"file": "^sssd\\.conf$",
+			"format": "ini",
+			"key": "\"domain/example.com\".ldap_tls_reqcert"
+		}
+	},
+
+	{
+		"object": "sssd-services",
+		"configkey": {
+			"path": "${root}",
+			"file": "^sssd\\.conf$",
+			"format": "ini",
+			"key": "sssd.services"
+		}
+	},
+
+	{
+		"object": "sssd-start-tls",
+		"configkey": {
+			"path": "${root}",
+			"file": "^sssd\\.conf$",
+			"format": "ini",
+			"key": "\"domain/example.com\".ldap_id_use_start_tls",
+			"exists": true
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "json0",
+		"expectedresult": true,
+		"object": "docker-icc",
+		"exactmatch": { "value": "false" }
+	},
+
+	{
+		"test": "json1",
+		"expectedresult": true,
+		"object": "docker-log-max-size",
+		"exactmatch": { "value": "10m" }
+	},
+
+	{
+		"test": "json2",
+		"expectedresult": true,
+		"object": "docker-log-max-file",
+		"numeric": { "operation": "<=", "value": "5" }
+	},
+
+	{
+		"test": "json3",
+		"expectedresult": true,
+		"object": "docker-nofile-hard",
+		"numeric": { "operation": ">=", "value": "64000" }
+	},
+
+	{
+		"test": "json4",
+		"expectedresult": true,
+		"object": "docker-authz-plugins",
+		"exactmatch": { "value": "false" }
+	},
+
+	{
+		"test": "json5",
+		"expectedresult": true,
+		"object": "docker-registries",
+		"exactmatch": { "value": "[]" }
+	},
+
+	{
+		"test": "yaml0",
+		"expectedresult": true,
+		"object": "kubelet-anonymous",
+		"exactmatch": { "value": "false" }
+	},
+
+	{
+		"test": "yaml1",
+		"expectedresult": true,
+		"object": "kubelet-readonly-port",
+		"numeric": { "operation": "=", "value": "0" }
+	},
+
+	{
+		"test": "yaml2",
+		"expectedresult": true,
+		"object": "kubelet-ciphers",
+		"match": "all",
+		"regexp": { "value": "_GCM_" }
+	},
+
+	{
+		"test": "yaml3",
+		"expectedresult": false,
+		"object": "kubelet-ciphers",
+		"regexp": { "value": "_CBC_" }
+	},
+
+	{
+		"test": "toml0",
+		"expectedresult": true,
+		"object": "containerd-selinux",
+		"exactmatch": { "value": "true" }
+	},
+
+	{
+		"test": "toml1",
+		"expectedresult": true,
+		"object": "containerd-grpc-size",
+		"numeric": { "operation": "=", "value": "16777216" }
+	},
+
+	{
+		"test": "toml2",
+		"expectedresult": true,
+		"object": "containerd-systemd-cgroup",
+		"exactmatch": { "value": "true" }
+	},
+
+	{
+		"test": "toml3",
+		"expectedresult": true,
+		"object": "containerd-snapshotters",
+		"exactmatch": { "value": "[\"aufs\",\"btrfs\"]" }
+	},
+
+	{
+		"test": "toml4",
+		"expectedresult": true,
+		"object": "containerd-proxy-names",
+		"match": "count",
+		"mincount": 2,
+		"maxcount": 2,
+		"regexp": { "value": "^(first|second)$" }
+	},
+
+	{
+		"test": "toml5",
+		"expectedresult": true,
+		"object": "containerd-proxy-description",
+		"exactmatch": { "value": "multi line" }
+	},
+
+	{
+		"test": "toml6",
+		"expectedresult": true,
+		"object": "containerd-proxy-started",
+		"exactmatch": { "value": "1979-05-27T07:32:00Z" }
+	},
+
+	{
+		"test": "ini0",
+		"expectedresult": true,
+		"object": "sssd-reqcert",
+		"exactmatch": { "value": "demand" }
+	},
+
+	{
+		"test": "ini1",
+		"expectedresult": true,
+		"object": "sssd-services",
+		"regexp": { "value": "\\bpam\\b" }
+	},
+
+	{
+		"test": "ini2",
+		"expectedresult": true,
+		"object": "sssd-start-tls",
+		"exactmatch": { "value": "false" }
+	}
+	]
+}
+`
+
+func TestConfigKeyPolicy(t *testing.T) {
+	genericTestExec(t, configKeyPolicyDoc)
+}
+
+// Used in TestConfigKeyParseError
+var configKeyParseErrorDoc = `
+objects:
+  - object: icc
+    configkey:
+      path: ./test/configkey
+      file: \.json$
+      format: json
+      key: icc
+      exists: true
+
+tests:
+  - test: icc
+    expectedresult: true
+    object: icc
+`
+
+func TestConfigKeyParseError(t *testing.T) {
+	a := genericTestExec(t, configKeyParseErrorDoc)
+	res, err := a.GetResults("icc")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	// The file that could not be parsed should be reported as a warning
+	// and produce no candidate.
+	if len(res.Results) != 1 || res.Results[0].Identifier != "test/configkey/daemon.json" {
+		t.Fatalf("unexpected results %+v", res.Results)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0].Path != "test/configkey/broken.json" {
+		t.Fatalf("unexpected warnings %+v", res.Warnings)
+	}
+}
+
+// Used in TestConfigKeyInvalidTOML
+var configKeyInvalidTOMLDoc = `
+objects:
+  - object: invalid
+    configkey:
+      path: ./test/configkey
+      file: ^(dotted|inline)\.toml$
+      format: toml
+      key: "*"
+      exists: true
+
+tests:
+  - test: invalid
+    expectedresult: false
+    object: invalid
+`
+
+func TestConfigKeyInvalidTOML(t *testing.T) {
+	a := genericTestExec(t, configKeyInvalidTOMLDoc)
+	res, err := a.GetResults("invalid")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(res.Results) != 0 {
+		t.Fatalf("unexpected results %+v", res.Results)
+	}
+	if len(res.Warnings) != 2 {
+		t.Fatalf("expected a warning for each file, got %+v", res.Warnings)
+	}
+}
+
+// Used in TestConfigKeyValues
+var configKeyValuesDoc = `
+objects:
+  - object: toml
+    configkey:
+      path: ./test/configvalues
+      file: \.toml$
+      format: toml
+      key: "*"
+  - object: yaml
+    configkey:
+      path: ./test/configvalues
+      file: \.yaml$
+      format: yaml
+      key: "*"
+  - object: json
+    configkey:
+      path: ./test/configvalues
+      file: \.json$
+      format: json
+      key: "*"
+
+tests:
+  - test: toml
+    expectedresult: true
+    object: toml
+  - test: yaml
+    expectedresult: true
+    object: yaml
+  - test: json
+    expectedresult: true
+    object: json
+`
+
+func TestConfigKeyValues(t *testing.T) {
+	a := genericTestExec(t, configKeyValuesDoc)
+	// Values are returned in the order of the keys in each file.
+	expect := map[string][]string{
+		"toml": {"5", "1979-05-27", "1979-05-27T07:32:00.5-08:00", "1000000",
+			"1000000", "0.25", "255", "1979-05-27T07:32:00", "07:32:00", "-Inf",
+			"493", "1000"},
+		"yaml": {"false", "true", "1000000", "31", "416", "yes", "0640", "true"},
+		"json": {"1e6", "1000000.0", "640"},
+	}
+	for k, v := range expect {
+		res, err := a.GetResults(k)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range res.Results {
+			got = append(got, x.Value)
+		}
+		if strings.Join(got, ",") != strings.Join(v, ",") {
+			t.Fatalf("%v: expected values %v, got %v", k, v, got)
+		}
+	}
+}
+
+func TestConfigKeyValidation(t *testing.T) {
+	obj := "objects:\n  - object: obj\n    configkey:\n      path: /\n      file: x\n"
+	for _, x := range []string{
+		"      key: a\n",
+		"      format: xml\n      key: a\n",
+		"      format: json\n",
+		"      format: json\n      key: a..b\n",
+		"      format: json\n      key: a[x]\n",
+		"      format: json\n      key: a[\"b\n",
+		"      format: json\n      key: a.\n",
+	} {
+		_, err := scribe.LoadDocument(strings.NewReader(obj + x))
+		if err == nil {
+			t.Fatalf("document with %q should not validate", x)
+		}
+	}
+}
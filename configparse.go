@@ -0,0 +1,56 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseINI parses an INI style configuration file. Keys that appear before
+// any section header are stored at the top level of the returned map, and
+// each section is stored as a map under the section name. Lines beginning
+// with ; or # are comments, and keys and values can be separated with = or :.
+// If a key appears more than once in a section, the last value is used.
+func parseINI(data string) (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+	cur := ret
+	for i, ln := range strings.Split(data, "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || ln[0] == ';' || ln[0] == '#' {
+			continue
+		}
+		if ln[0] == '[' {
+			if ln[len(ln)-1] != ']' {
+				return nil, fmt.Errorf("line %v: invalid section header", i+1)
+			}
+			name := strings.TrimSpace(ln[1 : len(ln)-1])
+			sect, ok := ret[name].(map[string]interface{})
+			if !ok {
+				sect = make(map[string]interface{})
+				ret[name] = sect
+			}
+			cur = sect
+			continue
+		}
+		idx := strings.IndexAny(ln, "=:")
+		if idx == -1 {
+			return nil, fmt.Errorf("line %v: expected key and value", i+1)
+		}
+		key := strings.TrimSpace(ln[:idx])
+		if key == "" {
+			return nil, fmt.Errorf("line %v: empty key", i+1)
+		}
+		val := strings.TrimSpace(ln[idx+1:])
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		cur[key] = val
+	}
+	return ret, nil
+}
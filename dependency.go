@@ -0,0 +1,176 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Dependency is a dependency expression for a test, which can be used in
+// addition to the If list of a test to control when the test applies. A
+// dependency is either a reference to another test by its identifier, in which
+// case it is true if the master result of that test is true, or a group of
+// dependencies.
+//
+// AllOf is true if all dependencies in the group are true, AnyOf is true if
+// at least one is true, and NoneOf is true if none of them are true. Groups
+// can be nested. A referenced test that results in an error only causes the
+// test to result in an error if it decides the result of the expression; for
+// example an AnyOf group with another member that is true is still true.
+//
+// In a document a reference to a test can be given as just the test
+// identifier, for example:
+//
+//	depends:
+//	  allof:
+//	    - anyof: [ centos6, centos7 ]
+//	    - noneof: [ container ]
+type Dependency struct {
+	Test   string       `json:"test,omitempty" yaml:"test,omitempty"`
+	AllOf  []Dependency `json:"allof,omitempty" yaml:"allof,omitempty"`
+	AnyOf  []Dependency `json:"anyof,omitempty" yaml:"anyof,omitempty"`
+	NoneOf []Dependency `json:"noneof,omitempty" yaml:"noneof,omitempty"`
+}
+
+// UnmarshalJSON allows a dependency to be specified as a test identifier
+// string, in addition to the object form.
+func (dep *Dependency) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*dep = Dependency{Test: s}
+		return nil
+	}
+	type plain Dependency
+	return json.Unmarshal(b, (*plain)(dep))
+}
+
+// UnmarshalYAML allows a dependency to be specified as a test identifier
+// string, in addition to the mapping form.
+func (dep *Dependency) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if unmarshal(&s) == nil {
+		*dep = Dependency{Test: s}
+		return nil
+	}
+	type plain Dependency
+	return unmarshal((*plain)(dep))
+}
+
+// tests returns the identifiers of all tests referenced in the expression.
+func (dep *Dependency) tests() (ret []string) {
+	if dep.Test != "" {
+		ret = append(ret, dep.Test)
+	}
+	for _, g := range [][]Dependency{dep.AllOf, dep.AnyOf, dep.NoneOf} {
+		for i := range g {
+			ret = append(ret, g[i].tests()...)
+		}
+	}
+	return ret
+}
+
+func (dep *Dependency) validate(d *Document, t *Test) error {
+	cnt := 0
+	if dep.Test != "" {
+		cnt++
+	}
+	for _, g := range [][]Dependency{dep.AllOf, dep.AnyOf, dep.NoneOf} {
+		if len(g) > 0 {
+			cnt++
+		}
+	}
+	if cnt != 1 {
+		return fmt.Errorf("dependency must have exactly one of test, allof, anyof or noneof")
+	}
+	if dep.Test != "" {
+		ptr, err := d.GetTest(dep.Test)
+		if err != nil {
+			return err
+		}
+		if ptr == t {
+			return fmt.Errorf("test cannot reference itself")
+		}
+		return nil
+	}
+	for _, g := range [][]Dependency{dep.AllOf, dep.AnyOf, dep.NoneOf} {
+		for i := range g {
+			err := g[i].validate(d, t)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evaluate returns the result of the dependency expression. All tests
+// referenced in the expression must have been run. A referenced test that
+// resulted in an error only causes an error if the result of the expression
+// depends on it; for example anyof is true if one member is true, even if
+// another member resulted in an error.
+func (dep *Dependency) evaluate(d *Document) (bool, error) {
+	if dep.Test != "" {
+		dt, err := d.GetTest(dep.Test)
+		if err != nil {
+			return false, err
+		}
+		if dt.err != nil {
+			return false, fmt.Errorf("a test dependency failed (\"%v\")", dep.Test)
+		}
+		return dt.masterResult, nil
+	}
+	// The groups are combined as if by allof, so any group that is false
+	// decides the result. An error is only returned if no group is false.
+	found, deperr := dependencyFind(d, dep.AllOf, false)
+	if found {
+		return false, nil
+	}
+	if len(dep.AnyOf) > 0 {
+		found, err := dependencyFind(d, dep.AnyOf, true)
+		if !found {
+			if err == nil {
+				return false, nil
+			}
+			if deperr == nil {
+				deperr = err
+			}
+		}
+	}
+	found, err := dependencyFind(d, dep.NoneOf, true)
+	if found {
+		return false, nil
+	}
+	if deperr == nil {
+		deperr = err
+	}
+	if deperr != nil {
+		return false, deperr
+	}
+	return true, nil
+}
+
+// dependencyFind returns true if any dependency in g evaluates to want. If
+// none do, the first error from a dependency that could not be evaluated is
+// returned.
+func dependencyFind(d *Document, g []Dependency, want bool) (bool, error) {
+	var ret error
+	for i := range g {
+		r, err := g[i].evaluate(d)
+		if err != nil {
+			if ret == nil {
+				ret = err
+			}
+			continue
+		}
+		if r == want {
+			return true, nil
+		}
+	}
+	return false, ret
+}
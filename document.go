@@ -8,20 +8,41 @@
 package scribe
 
 import (
+	"context"
 	"fmt"
+	"sync"
 )
 
 // Document describes a scribe document; a document contains all tests and other
 // infomration used to execute a policy check
 type Document struct {
-	Variables []Variable `json:"variables,omitempty" yaml:"variables,omitempty"`
-	Objects   []Object   `json:"objects,omitempty" yaml:"objects,omitempty"`
-	Tests     []Test     `json:"tests,omitempty" yaml:"tests,omitempty"`
+	Options   DocumentOptions `json:"options,omitempty" yaml:"options,omitempty"`
+	Variables []Variable      `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Objects   []Object        `json:"objects,omitempty" yaml:"objects,omitempty"`
+	Tests     []Test          `json:"tests,omitempty" yaml:"tests,omitempty"`
+
+	engine   *Engine       // The engine the document is associated with.
+	object   *Object       // The object being prepared, see forObject().
+	fsIndex  *fileIndex    // File system cache for the current analysis.
+	pkgCache *packageCache // Package cache for the current analysis.
+
+	analyzed bool // True for the copy of a document made by Analyze.
+}
+
+// DocumentOptions contains options that control how a document is analyzed.
+//
+// If WarningsAsErrors is true, any warnings recorded while preparing an object
+// (for example a file that could not be read) will cause tests that reference
+// the object to result in an error, rather than the warnings only being
+// reported alongside the result.
+type DocumentOptions struct {
+	WarningsAsErrors bool `json:"warningsaserrors,omitempty" yaml:"warningsaserrors,omitempty"`
 }
 
 // Validate a scribe document for consistency. This identifies any errors in
-// the document that are not JSON syntax related, including missing fields or
-// references to tests that do not exist. Returns an error if validation fails.
+// the document that are not JSON syntax related, including missing fields,
+// references to tests that do not exist, or cycles in test dependencies or
+// object import chains. Returns an error if validation fails.
 func (d *Document) Validate() error {
 	for i := range d.Objects {
 		err := d.Objects[i].validate(d)
@@ -35,7 +56,27 @@ func (d *Document) Validate() error {
 			return err
 		}
 	}
-	return nil
+	err := d.checkChainCycles()
+	if err != nil {
+		return err
+	}
+	_, err = d.testOrder()
+	return err
+}
+
+// clone returns a copy of the document with no analysis state, which does not
+// share any state that is modified during analysis with d.
+func (d *Document) clone() Document {
+	ret := Document{Options: d.Options, Variables: d.Variables, engine: d.engine}
+	ret.Objects = make([]Object, len(d.Objects))
+	for i := range d.Objects {
+		ret.Objects[i] = d.Objects[i].clone()
+	}
+	ret.Tests = make([]Test, len(d.Tests))
+	for i := range d.Tests {
+		ret.Tests[i] = d.Tests[i].clone()
+	}
+	return ret
 }
 
 // GetTestIdentifiers returns the test identifiers for all tests present in
@@ -48,7 +89,84 @@ func (d *Document) GetTestIdentifiers() []string {
 	return ret
 }
 
-func (d *Document) prepareObjects() error {
+// getEngine returns the engine associated with the document, or the default
+// engine if the document was not loaded or analyzed using a specific engine.
+func (d *Document) getEngine() *Engine {
+	if d == nil || d.engine == nil {
+		return defaultEngine
+	}
+	return d.engine
+}
+
+func (d *Document) debugPrint(s string, args ...interface{}) {
+	e := d.getEngine()
+	if !e.debugging {
+		return
+	}
+	if d != nil && d.object != nil {
+		s = "[" + d.object.Object + "] " + s
+	}
+	e.debugPrint(s, args...)
+}
+
+// warn records a soft error that occurred while preparing the current object
+// against path. Warnings do not stop preparation of the object, but are
+// reported in the results of any tests that reference it.
+func (d *Document) warn(path string, err error) {
+	d.debugPrint("warning: %v: %v\n", path, err)
+	if d.object == nil {
+		return
+	}
+	d.object.warnings = append(d.object.warnings, objectWarning{path: path, err: err})
+}
+
+// addWarnings records each warning in w against the current object.
+func (d *Document) addWarnings(w []objectWarning) {
+	for _, x := range w {
+		d.warn(x.path, x.err)
+	}
+}
+
+// forObject returns a shallow copy of the document for use while preparing
+// object o. Debug output written through the copy is prefixed with the object
+// name, so output remains attributable when objects are being prepared
+// concurrently, and any warnings are recorded against o.
+func (d *Document) forObject(o *Object) *Document {
+	ret := *d
+	ret.object = o
+	return &ret
+}
+
+// forEachObject calls f for each object in the document which is not part of
+// an import chain, using up to the configured number of parallel workers for
+// the engine.
+func (d *Document) forEachObject(f func(*Object)) {
+	workers := d.getEngine().parallelism
+	if workers < 1 {
+		workers = 1
+	}
+	work := make(chan *Object)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range work {
+				f(o)
+			}
+		}()
+	}
+	for i := range d.Objects {
+		if d.Objects[i].isChain {
+			continue
+		}
+		work <- &d.Objects[i]
+	}
+	close(work)
+	wg.Wait()
+}
+
+func (d *Document) prepareObjects(ctx context.Context) error {
 	// Mark any chain objects; these will be skipped during preparation
 	// as they are dependent on evaluation of the root object. Chain
 	// objects are objects that contain chain variables; that is they
@@ -61,13 +179,16 @@ func (d *Document) prepareObjects() error {
 	// but we don't propagate this back. Errors within object preparation
 	// are kept localized to the object, and are not considered fatal to
 	// execution of the entire document.
-	for i := range d.Objects {
-		d.Objects[i].prepare(d)
-	}
-	debugPrint("prepareObjects(): firing any import chains\n")
-	for i := range d.Objects {
-		d.Objects[i].fireChains(d)
-	}
+	//
+	// Objects are independent of each other at this stage, so they are
+	// prepared concurrently. Each object only modifies its own state.
+	d.forEachObject(func(o *Object) {
+		o.prepare(ctx, d)
+	})
+	d.debugPrint("prepareObjects(): firing any import chains\n")
+	d.forEachObject(func(o *Object) {
+		o.fireChains(ctx, d)
+	})
 	return nil
 }
 
@@ -89,11 +210,25 @@ func (d *Document) objectPrepared(obj string) (bool, error) {
 	return objptr.prepared, nil
 }
 
+func (d *Document) getObject(obj string) (*Object, error) {
+	for i := range d.Objects {
+		if d.Objects[i].Object == obj {
+			return &d.Objects[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown object \"%v\"", obj)
+}
+
 func (d *Document) runTests() error {
+	order, err := d.testOrder()
+	if err != nil {
+		return err
+	}
 	// As documented prepareObjects(), we don't propagate errors here but
 	// instead keep them localized to the test.
-	for i := range d.Tests {
-		d.Tests[i].runTest(d)
+	for _, x := range order {
+		t, _ := d.GetTest(x)
+		t.runTest(d)
 	}
 	return nil
 }
@@ -0,0 +1,190 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dpkgStatusSource is a PackageSource that reads the dpkg status database
+// directly, rather than executing dpkg.
+type dpkgStatusSource struct {
+	root string
+}
+
+// NewDpkgStatusSource returns a PackageSource named "dpkg" that reads package
+// information from the dpkg status database under root, without requiring the
+// dpkg binary. Both var/lib/dpkg/status and the per-package files in
+// var/lib/dpkg/status.d (as used on distroless images) are read. Setting root
+// to something other than "/" can be used to inspect a mounted image or
+// container file system.
+//
+// Only packages with a status of "install ok installed" or "hold ok installed"
+// are returned. If neither status location exists under root, the source
+// returns no packages.
+func NewDpkgStatusSource(root string) PackageSource {
+	return &dpkgStatusSource{root: root}
+}
+
+func (s *dpkgStatusSource) Name() string {
+	return "dpkg"
+}
+
+func (s *dpkgStatusSource) Packages(ctx context.Context) ([]PackageInfo, error) {
+	ret := make([]PackageInfo, 0)
+	all, err := ReadDpkgStatus(ctx, s.root)
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range all {
+		if !dpkgInstalled(x.Status) {
+			continue
+		}
+		ret = append(ret, x)
+	}
+	return ret, nil
+}
+
+// ReadDpkgStatus reads the dpkg status database under root, returning an entry
+// for every package described in it regardless of the package status. The
+// Source field of each entry is set to the source package name (which is the
+// same as the package name unless the database says otherwise), and the Status
+// field contains the dpkg status, for example "install ok installed".
+//
+// Entries in var/lib/dpkg/status.d that do not have a status are treated as
+// installed, since that is how these files are used on distroless images.
+func ReadDpkgStatus(ctx context.Context, root string) ([]PackageInfo, error) {
+	ret := make([]PackageInfo, 0)
+	base := filepath.Join(root, "var", "lib", "dpkg")
+
+	pkgs, err := dpkgReadStatusFile(ctx, filepath.Join(base, "status"), "")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ret = append(ret, pkgs...)
+
+	dirents, err := ioutil.ReadDir(filepath.Join(base, "status.d"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, x := range dirents {
+		// status.d can also contain md5sums files for each package,
+		// which do not contain package information.
+		if x.IsDir() || strings.HasSuffix(x.Name(), ".md5sums") {
+			continue
+		}
+		names = append(names, x.Name())
+	}
+	sort.Strings(names)
+	for _, x := range names {
+		pkgs, err := dpkgReadStatusFile(ctx, filepath.Join(base, "status.d", x), "install ok installed")
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, pkgs...)
+	}
+	return ret, nil
+}
+
+// dpkgReadStatusFile parses a file in dpkg control file format, returning the
+// packages described in it. If a package has no Status field, defstatus is
+// used.
+func dpkgReadStatusFile(ctx context.Context, path string, defstatus string) ([]PackageInfo, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return dpkgParseStatus(ctx, fd, defstatus)
+}
+
+func dpkgParseStatus(ctx context.Context, r io.Reader, defstatus string) ([]PackageInfo, error) {
+	ret := make([]PackageInfo, 0)
+	fields := make(map[string]string)
+
+	// Each paragraph in the file describes a package; convert the fields
+	// we are interested in once we reach the end of it.
+	flush := func() {
+		defer func() {
+			fields = make(map[string]string)
+		}()
+		name := fields["package"]
+		if name == "" {
+			return
+		}
+		newpkg := PackageInfo{}
+		newpkg.Name = name
+		newpkg.Version = fields["version"]
+		newpkg.Arch = fields["architecture"]
+		newpkg.Type = "dpkg"
+		newpkg.Status = fields["status"]
+		if newpkg.Status == "" {
+			newpkg.Status = defstatus
+		}
+		// The source field can include the version of the source
+		// package in parentheses, which we do not need.
+		newpkg.Source = name
+		if src := strings.Fields(fields["source"]); len(src) > 0 {
+			newpkg.Source = src[0]
+		}
+		ret = append(ret, newpkg)
+	}
+
+	rdr := bufio.NewReader(r)
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		ln, err := rdr.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		ln = strings.TrimRight(ln, "\r\n")
+		if strings.TrimSpace(ln) == "" {
+			flush()
+		} else if ln[0] != ' ' && ln[0] != '\t' {
+			// Continuation lines (for example in Description) are
+			// not needed and are skipped.
+			idx := strings.Index(ln, ":")
+			if idx != -1 {
+				key := strings.ToLower(strings.TrimSpace(ln[:idx]))
+				fields[key] = strings.TrimSpace(ln[idx+1:])
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	flush()
+	return ret, nil
+}
+
+// dpkgInstalled returns true if the dpkg status string indicates the package
+// is installed; the status is made up of the desired action, an error flag,
+// and the package state. Only installed packages that are wanted (install or
+// hold) and have no error flag are considered installed. A package marked for
+// removal or purge, such as "deinstall ok installed", is still present on the
+// system but is not returned, since it is about to be removed.
+func dpkgInstalled(status string) bool {
+	s := strings.Fields(status)
+	if len(s) != 3 || s[1] != "ok" || s[2] != "installed" {
+		return false
+	}
+	return s[0] == "install" || s[0] == "hold"
+}
@@ -0,0 +1,160 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This is a go version of the dpkg verrevcmp() function and the version
+// comparison rules from dpkg, as described in deb-version(7). It differs from
+// the rpm comparison mainly in that ~ sorts before anything (including the end
+// of the string), and that non-alphanumeric characters are significant.
+
+type dpkgVersion struct {
+	epoch    int
+	upstream string
+	revision string
+}
+
+// dpkgParseVersion splits a Debian version string into its epoch, upstream
+// version and revision components. The epoch is everything before the first
+// colon, and the revision everything after the last hyphen.
+func dpkgParseVersion(s string) (ret dpkgVersion, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ret, fmt.Errorf("dpkgParseVersion: empty version string")
+	}
+	if strings.ContainsAny(s, " \t") {
+		return ret, fmt.Errorf("dpkgParseVersion: version string has embedded spaces")
+	}
+	remain := s
+	if idx := strings.Index(s, ":"); idx != -1 {
+		ret.epoch, err = strconv.Atoi(s[:idx])
+		if err != nil || ret.epoch < 0 {
+			return ret, fmt.Errorf("dpkgParseVersion: bad epoch in \"%v\"", s)
+		}
+		remain = s[idx+1:]
+	}
+	if idx := strings.LastIndex(remain, "-"); idx != -1 {
+		ret.revision = remain[idx+1:]
+		if ret.revision == "" {
+			return ret, fmt.Errorf("dpkgParseVersion: revision is empty in \"%v\"", s)
+		}
+		remain = remain[:idx]
+	}
+	if remain == "" {
+		return ret, fmt.Errorf("dpkgParseVersion: upstream version is empty in \"%v\"", s)
+	}
+	ret.upstream = remain
+	return ret, nil
+}
+
+func dpkgIsDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func dpkgIsAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// dpkgOrder returns the sort weight of a character in a non-digit part of a
+// version; the end of the string is represented by 0.
+func dpkgOrder(c byte) int {
+	switch {
+	case dpkgIsDigit(c):
+		return 0
+	case dpkgIsAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	case c != 0:
+		return int(c) + 256
+	}
+	return 0
+}
+
+// dpkgVerRevCmp compares two upstream version or revision strings, returning
+// a negative value if a is older than b, a positive value if a is newer than b
+// and 0 if they are equal.
+func dpkgVerRevCmp(a string, b string) int {
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		firstdiff := 0
+		for (i < len(a) && !dpkgIsDigit(a[i])) || (j < len(b) && !dpkgIsDigit(b[j])) {
+			ac := dpkgOrder(at(a, i))
+			bc := dpkgOrder(at(b, j))
+			if ac != bc {
+				return ac - bc
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		for i < len(a) && dpkgIsDigit(a[i]) && j < len(b) && dpkgIsDigit(b[j]) {
+			if firstdiff == 0 {
+				firstdiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && dpkgIsDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && dpkgIsDigit(b[j]) {
+			return -1
+		}
+		if firstdiff != 0 {
+			return firstdiff
+		}
+	}
+	return 0
+}
+
+// dpkgCompare compares two Debian version strings. The return value follows
+// the convention used by evrRpmCompare; 1 if check is newer than actual, -1 if
+// actual is newer than check, and 0 if they are equal.
+func dpkgCompare(actual string, check string) (int, error) {
+	va, err := dpkgParseVersion(actual)
+	if err != nil {
+		return 0, err
+	}
+	vc, err := dpkgParseVersion(check)
+	if err != nil {
+		return 0, err
+	}
+	if vc.epoch != va.epoch {
+		if vc.epoch > va.epoch {
+			return 1, nil
+		}
+		return -1, nil
+	}
+	ret := dpkgVerRevCmp(vc.upstream, va.upstream)
+	if ret == 0 {
+		ret = dpkgVerRevCmp(vc.revision, va.revision)
+	}
+	if ret > 0 {
+		return 1, nil
+	} else if ret < 0 {
+		return -1, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,158 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Engine is an isolated instance of the scribe policy evaluator. All runtime
+// configuration (debugging, file location, package information and result
+// callbacks) is held by the engine, so multiple engines can be used within the
+// same process without affecting each other.
+//
+// The LoadDocument, Analyze, AnalyzeDocument and AnalyzeDocumentContext methods
+// of an Engine are safe for concurrent use by multiple goroutines.
+type Engine struct {
+	debugging   bool
+	debugWriter io.Writer
+	excall      func(TestResult)
+	testHooks   bool
+	profiling   bool
+	fileLocator FileLocator
+	pkgSources  []PackageSource
+
+	objectTimeout   time.Duration // Time budget for preparing each object.
+	documentTimeout time.Duration // Time budget for analyzing a document.
+	parallelism     int           // Maximum number of objects prepared at once.
+	fileCacheSize   int64         // Maximum size of file content cached by an analysis.
+
+	debugLock sync.Mutex // Serializes writes to debugWriter.
+
+}
+
+// EngineOption is used to configure an Engine when it is created with
+// NewEngine.
+type EngineOption func(*Engine)
+
+// WithDebug enables debugging for the engine, with debug output being written
+// to w.
+func WithDebug(w io.Writer) EngineOption {
+	return func(e *Engine) {
+		e.debugging = true
+		e.debugWriter = w
+	}
+}
+
+// WithExpectedCallback sets an expected result callback for the engine; see
+// ExpectedCallback for details.
+func WithExpectedCallback(f func(TestResult)) EngineOption {
+	return func(e *Engine) {
+		e.excall = f
+	}
+}
+
+// WithFileLocator installs an alternate file location function for the
+// engine; see InstallFileLocator for details. If the engine prepares objects
+// concurrently (see WithParallelism), f must be safe for concurrent use.
+func WithFileLocator(f FileLocator) EngineOption {
+	return func(e *Engine) {
+		e.fileLocator = f
+	}
+}
+
+// WithObjectTimeout sets a time budget for the preparation of each object in a
+// document. If preparing an object takes longer than d, preparation of the
+// object is abandoned and tests referencing it will result in ErrTimeout.
+func WithObjectTimeout(d time.Duration) EngineOption {
+	return func(e *Engine) {
+		e.objectTimeout = d
+	}
+}
+
+// WithDocumentTimeout sets a time budget for the analysis of a document. Any
+// objects that have not been prepared when the budget expires are abandoned,
+// and tests referencing them will result in ErrTimeout.
+func WithDocumentTimeout(d time.Duration) EngineOption {
+	return func(e *Engine) {
+		e.documentTimeout = d
+	}
+}
+
+// WithParallelism sets the maximum number of objects that will be prepared
+// concurrently while analyzing a document, for example runtime.NumCPU(). The
+// default is 1, which prepares objects one after the other.
+func WithParallelism(n int) EngineOption {
+	return func(e *Engine) {
+		if n < 1 {
+			n = 1
+		}
+		e.parallelism = n
+	}
+}
+
+// WithFileCacheSize sets the maximum total size in bytes of the file content
+// that is kept in memory while analyzing a document, so that files examined by
+// more than one object are only read once. The default is 64 MiB. If n is 0,
+// file content is not kept, and files are read each time they are examined.
+func WithFileCacheSize(n int64) EngineOption {
+	return func(e *Engine) {
+		if n < 0 {
+			n = 0
+		}
+		e.fileCacheSize = n
+	}
+}
+
+// WithPackageSources sets the package sources the engine will use to obtain
+// the list of packages installed on the system, instead of the package sources
+// in the registry (see RegisterPackageSource).
+func WithPackageSources(srcs ...PackageSource) EngineOption {
+	return func(e *Engine) {
+		e.pkgSources = make([]PackageSource, len(srcs))
+		copy(e.pkgSources, srcs)
+	}
+}
+
+// WithProfiling enables profiling for the engine; see SetProfiling for
+// details.
+func WithProfiling(f bool) EngineOption {
+	return func(e *Engine) {
+		e.profiling = f
+	}
+}
+
+// WithTestHooks enables test hooks for the engine; see TestHooks for details.
+func WithTestHooks(f bool) EngineOption {
+	return func(e *Engine) {
+		e.testHooks = f
+	}
+}
+
+// NewEngine returns a new Engine configured using the supplied options.
+func NewEngine(opts ...EngineOption) *Engine {
+	e := &Engine{parallelism: 1, fileCacheSize: fileIndexDefaultCacheSize}
+	for _, x := range opts {
+		x(e)
+	}
+	e.debugPrint("debugging enabled\n")
+	return e
+}
+
+func (e *Engine) debugPrint(s string, args ...interface{}) {
+	if e == nil || !e.debugging {
+		return
+	}
+	buf := fmt.Sprintf(s, args...)
+	e.debugLock.Lock()
+	fmt.Fprintf(e.debugWriter, "[scribe] %v", buf)
+	e.debugLock.Unlock()
+}
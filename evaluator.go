@@ -0,0 +1,203 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Evaluator describes the criteria a test applies to the data returned by an
+// object. Only one of the fields should be set.
+//
+// All, Any and Not can be used to combine other evaluators. All is true if
+// every evaluator in the list is true, Any is true if at least one of them is,
+// and Not inverts the result of the evaluator it contains. For example, a
+// version that is at least 2.0 and is not a beta could be expressed as:
+//
+//	all:
+//	  - semver:
+//	      operation: ">="
+//	      value: 2.0.0
+//	  - not:
+//	      regexp:
+//	        value: -beta
+//
+// Combinations can be nested, and each evaluator within a combination is
+// applied to the same value from the object.
+type Evaluator struct {
+	EVR     EVRTest     `json:"evr,omitempty" yaml:"evr,omitempty"`               // EVR version comparison
+	Regexp  Regex       `json:"regexp,omitempty" yaml:"regexp,omitempty"`         // Regular expression comparison
+	EMatch  ExactMatch  `json:"exactmatch,omitempty" yaml:"exactmatch,omitempty"` // Exact string match
+	Semver  SemverTest  `json:"semver,omitempty" yaml:"semver,omitempty"`         // Semantic version comparison
+	Numeric NumericTest `json:"numeric,omitempty" yaml:"numeric,omitempty"`       // Numeric comparison
+
+	All []Evaluator `json:"all,omitempty" yaml:"all,omitempty"` // True if all evaluators are true
+	Any []Evaluator `json:"any,omitempty" yaml:"any,omitempty"` // True if any evaluator is true
+	Not *Evaluator  `json:"not,omitempty" yaml:"not,omitempty"` // Inverts the evaluator result
+}
+
+// evaluators returns the evaluation interface for each evaluator that has been
+// set, in order of precedence.
+func (e *Evaluator) evaluators() (ret []genericEvaluator) {
+	if e.EVR.isSet() {
+		ret = append(ret, &e.EVR)
+	}
+	if e.Regexp.Value != "" {
+		ret = append(ret, &e.Regexp)
+	}
+	if e.EMatch.Value != "" {
+		ret = append(ret, &e.EMatch)
+	}
+	if e.Semver.isSet() {
+		ret = append(ret, &e.Semver)
+	}
+	if e.Numeric.Value != "" {
+		ret = append(ret, &e.Numeric)
+	}
+	if len(e.All) > 0 {
+		ret = append(ret, allEvaluator(e.All))
+	}
+	if len(e.Any) > 0 {
+		ret = append(ret, anyEvaluator(e.Any))
+	}
+	if e.Not != nil {
+		ret = append(ret, &notEvaluator{e.Not})
+	}
+	return ret
+}
+
+// getEvaluationInterface returns the evaluation interface for the evaluator,
+// or nil if no evaluator has been set.
+func (e *Evaluator) getEvaluationInterface() genericEvaluator {
+	evs := e.evaluators()
+	if len(evs) == 0 {
+		return nil
+	}
+	return evs[0]
+}
+
+func (e *Evaluator) validate() error {
+	if e.EVR.isSet() {
+		err := e.EVR.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if e.Semver.isSet() {
+		err := e.Semver.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if e.Numeric.Value != "" {
+		err := e.Numeric.validate()
+		if err != nil {
+			return err
+		}
+	}
+	for i := range e.All {
+		err := e.All[i].validateNested("all")
+		if err != nil {
+			return err
+		}
+	}
+	for i := range e.Any {
+		err := e.Any[i].validateNested("any")
+		if err != nil {
+			return err
+		}
+	}
+	if e.Not != nil {
+		return e.Not.validateNested("not")
+	}
+	return nil
+}
+
+// validateNested validates an evaluator that is part of a combination, which
+// must have exactly one evaluator set.
+func (e *Evaluator) validateNested(comb string) error {
+	switch n := len(e.evaluators()); {
+	case n == 0:
+		return fmt.Errorf("%v: evaluator has no criteria", comb)
+	case n > 1:
+		return fmt.Errorf("%v: evaluator has more than one criteria", comb)
+	}
+	return e.validate()
+}
+
+// describeResult returns a description of an evaluation result for use in the
+// expression of a combination.
+func describeResult(r evaluationResult) string {
+	if r.expression == "" {
+		return r.evaluator
+	}
+	if r.evaluator == "not" {
+		return r.expression
+	}
+	return "(" + r.expression + ")"
+}
+
+type allEvaluator []Evaluator
+
+func (a allEvaluator) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
+	ret.criteria = c
+	ret.evaluator = "all"
+	ret.result = true
+	desc := make([]string, 0)
+	// Every evaluator is applied even once the result is known, so the
+	// expression includes the evidence for each of them.
+	for i := range a {
+		r, err := a[i].getEvaluationInterface().evaluate(d, c)
+		if err != nil {
+			return ret, err
+		}
+		if !r.result {
+			ret.result = false
+		}
+		desc = append(desc, describeResult(r))
+	}
+	ret.expression = strings.Join(desc, " && ")
+	return ret, nil
+}
+
+type anyEvaluator []Evaluator
+
+func (a anyEvaluator) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
+	ret.criteria = c
+	ret.evaluator = "any"
+	desc := make([]string, 0)
+	for i := range a {
+		r, err := a[i].getEvaluationInterface().evaluate(d, c)
+		if err != nil {
+			return ret, err
+		}
+		if r.result {
+			ret.result = true
+		}
+		desc = append(desc, describeResult(r))
+	}
+	ret.expression = strings.Join(desc, " || ")
+	return ret, nil
+}
+
+type notEvaluator struct {
+	e *Evaluator
+}
+
+func (n *notEvaluator) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
+	ret.criteria = c
+	ret.evaluator = "not"
+	r, err := n.e.getEvaluationInterface().evaluate(d, c)
+	if err != nil {
+		return ret, err
+	}
+	ret.result = !r.result
+	ret.expression = "!" + describeResult(r)
+	return ret, nil
+}
@@ -0,0 +1,453 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"context"
+	"github.com/mozilla/scribe"
+	"strings"
+	"testing"
+)
+
+// Used in TestSemverPolicy
+var semverPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "version-123",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "app", "value": "v1.2.3" }
+			]
+		}
+	},
+
+	{
+		"object": "version-rc",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "app", "value": "1.3.0-rc.1+build.7" }
+			]
+		}
+	},
+
+	{
+		"object": "version-zero",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "app", "value": "0.2.5" }
+			]
+		}
+	},
+
+	{
+		"object": "version-invalid",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "app", "value": "1.2" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "semver0",
+		"expectedresult": true,
+		"object": "version-123",
+		"semver": { "operation": ">=", "value": "1.2.3" }
+	},
+
+	{
+		"test": "semver1",
+		"expectedresult": true,
+		"object": "version-rc",
+		"semver": { "operation": "<", "value": "1.3.0" }
+	},
+
+	{
+		"test": "semver2",
+		"expectedresult": false,
+		"object": "version-rc",
+		"semver": { "operation": "<", "value": "1.3.0-beta.2" }
+	},
+
+	{
+		"test": "semver3",
+		"expectedresult": true,
+		"object": "version-rc",
+		"semver": { "operation": "=", "value": "1.3.0-rc.1" }
+	},
+
+	{
+		"test": "semver4",
+		"expectedresult": true,
+		"object": "version-123",
+		"semver": { "constraint": "^1.0.0" }
+	},
+
+	{
+		"test": "semver5",
+		"expectedresult": false,
+		"object": "version-123",
+		"semver": { "constraint": "~1.1" }
+	},
+
+	{
+		"test": "semver6",
+		"expectedresult": true,
+		"object": "version-123",
+		"semver": { "constraint": "~1.1 || >= 1.2.0 <1.2.4" }
+	},
+
+	{
+		"test": "semver7",
+		"expectedresult": false,
+		"object": "version-rc",
+		"semver": { "constraint": "^1.2.0" }
+	},
+
+	{
+		"test": "semver8",
+		"expectedresult": true,
+		"object": "version-rc",
+		"semver": { "constraint": ">=1.3.0-rc.0 <1.4.0" }
+	},
+
+	{
+		"test": "semver9",
+		"expectedresult": true,
+		"object": "version-zero",
+		"semver": { "constraint": "^0.2.3" }
+	},
+
+	{
+		"test": "semver10",
+		"expectedresult": false,
+		"object": "version-zero",
+		"semver": { "constraint": "^0.1" }
+	},
+
+	{
+		"test": "semver11",
+		"expecterror": true,
+		"object": "version-invalid",
+		"semver": { "operation": ">", "value": "1.0.0" }
+	}
+	]
+}
+`
+
+func TestSemverPolicy(t *testing.T) {
+	genericTestExec(t, semverPolicyDoc)
+}
+
+func TestSemverValidation(t *testing.T) {
+	invalid := []string{
+		`{ "operation": "<", "value": "1.2" }`,
+		`{ "operation": "~", "value": "1.2.3" }`,
+		`{ "constraint": "^1.x" }`,
+		`{ "constraint": ">=1.0.0 ||" }`,
+		`{ "constraint": "^1.0.0", "operation": "<", "value": "1.2.3" }`,
+	}
+	for _, x := range invalid {
+		doc := `{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "1.0.0"}]}}],
+		"tests": [{"test": "t", "object": "o", "semver": ` + x + `}]}`
+		_, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err == nil {
+			t.Fatalf("LoadDocument: expected error for semver %v", x)
+		}
+	}
+}
+
+// Used in TestNumericPolicy
+var numericPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "pass-max-days",
+		"filecontent": {
+			"path": "./test/numeric",
+			"file": "login.defs",
+			"expression": "^PASS_MAX_DAYS\\s+(\\S+)"
+		}
+	},
+
+	{
+		"object": "umask",
+		"filecontent": {
+			"path": "./test/numeric",
+			"file": "login.defs",
+			"expression": "^UMASK\\s+(\\S+)"
+		}
+	},
+
+	{
+		"object": "load-limit",
+		"filecontent": {
+			"path": "./test/numeric",
+			"file": "login.defs",
+			"expression": "^LOAD_LIMIT\\s+(\\S+)"
+		}
+	},
+
+	{
+		"object": "mail-limit",
+		"filecontent": {
+			"path": "./test/numeric",
+			"file": "login.defs",
+			"expression": "^MAIL_LIMIT\\s+(\\S+)"
+		}
+	},
+
+	{
+		"object": "encrypt-method",
+		"filecontent": {
+			"path": "./test/numeric",
+			"file": "login.defs",
+			"expression": "^ENCRYPT_METHOD\\s+(\\S+)"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "numeric0",
+		"expectedresult": true,
+		"object": "pass-max-days",
+		"numeric": { "operation": "<=", "value": "90" }
+	},
+
+	{
+		"test": "numeric1",
+		"expectedresult": false,
+		"object": "pass-max-days",
+		"numeric": { "operation": "<", "value": "90" }
+	},
+
+	{
+		"test": "numeric2",
+		"expectedresult": true,
+		"object": "pass-max-days",
+		"numeric": { "operation": "!=", "value": "99999" }
+	},
+
+	{
+		"test": "numeric3",
+		"expectedresult": true,
+		"object": "umask",
+		"numeric": { "operation": "=", "value": "18" }
+	},
+
+	{
+		"test": "numeric4",
+		"expectedresult": true,
+		"object": "umask",
+		"numeric": { "operation": ">=", "value": "022" }
+	},
+
+	{
+		"test": "numeric5",
+		"expectedresult": true,
+		"object": "load-limit",
+		"numeric": { "operation": ">", "value": "0.5" }
+	},
+
+	{
+		"test": "numeric6",
+		"expectedresult": false,
+		"object": "load-limit",
+		"numeric": { "operation": ">=", "value": "1" }
+	},
+
+	{
+		"test": "numeric7",
+		"expectedresult": true,
+		"object": "mail-limit",
+		"numeric": { "operation": "=", "value": "16" }
+	},
+
+	{
+		"test": "numeric8",
+		"expecterror": true,
+		"object": "encrypt-method",
+		"numeric": { "operation": ">", "value": "0" }
+	}
+	]
+}
+`
+
+func TestNumericPolicy(t *testing.T) {
+	genericTestExec(t, numericPolicyDoc)
+}
+
+func TestNumericValidation(t *testing.T) {
+	invalid := []string{
+		`{ "operation": "<", "value": "ten" }`,
+		`{ "operation": "<", "value": "NaN" }`,
+		`{ "operation": "<", "value": "08" }`,
+		`{ "operation": "<", "value": "0o22" }`,
+		`{ "operation": "<", "value": "1_000" }`,
+		`{ "operation": "=~", "value": "10" }`,
+	}
+	for _, x := range invalid {
+		doc := `{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "1"}]}}],
+		"tests": [{"test": "t", "object": "o", "numeric": ` + x + `}]}`
+		_, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err == nil {
+			t.Fatalf("LoadDocument: expected error for numeric %v", x)
+		}
+	}
+}
+
+func TestNumericParsing(t *testing.T) {
+	tests := []struct {
+		actual string
+		value  string
+		err    bool // Parsing actual should fail.
+	}{
+		{"010", "8", false},
+		{"00", "0", false},
+		{"-010", "-8", false},
+		{"+12", "12", false},
+		{"0x1F", "31", false},
+		{"-0x10", "-16", false},
+		{"1e3", "1000", false},
+		{"010.5", "10.5", false},
+		{"0.5", ".5", false},
+		{"9223372036854775807", "0x7fffffffffffffff", false},
+		{"08", "8", true},
+		{"090", "90", true},
+		{"0b101", "5", true},
+		{"0o17", "15", true},
+		{"1_000", "1000", true},
+		{"0x", "0", true},
+		{"0x1p4", "16", true},
+		{"--1", "1", true},
+		{"Inf", "0", true},
+	}
+	for _, x := range tests {
+		doc := `{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "` +
+			x.actual + `"}]}}], "tests": [{"test": "t", "object": "o", "numeric": {"operation": "=", "value": "` +
+			x.value + `"}}]}`
+		d, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("LoadDocument: %v", err)
+		}
+		a, err := scribe.Analyze(context.Background(), d)
+		if err != nil {
+			t.Fatalf("Analyze: %v", err)
+		}
+		res, err := a.GetResults("t")
+		if err != nil {
+			t.Fatalf("GetResults: %v", err)
+		}
+		if res.IsError != x.err {
+			t.Fatalf("%v: expected error %v, got %+v", x.actual, x.err, res)
+		}
+		if !x.err && !res.MasterResult {
+			t.Fatalf("%v: expected to equal %v", x.actual, x.value)
+		}
+	}
+}
+
+// Used in TestCombinatorPolicy
+var combinatorPolicyDoc = `
+objects:
+  - object: version-beta
+    raw:
+      identifiers:
+        - identifier: app
+          value: 2.1.0-beta.1
+  - object: version-stable
+    raw:
+      identifiers:
+        - identifier: app
+          value: 2.1.0
+
+tests:
+  - test: combinator0
+    expectedresult: true
+    object: version-stable
+    all:
+      - semver:
+          operation: ">="
+          value: 2.0.0
+      - not:
+          regexp:
+            value: -beta
+  - test: combinator1
+    expectedresult: false
+    object: version-beta
+    all:
+      - semver:
+          operation: ">="
+          value: 2.0.0
+      - not:
+          regexp:
+            value: -beta
+  - test: combinator2
+    expectedresult: true
+    object: version-beta
+    any:
+      - exactmatch:
+          value: 2.1.0
+      - regexp:
+          value: -beta
+  - test: combinator3
+    expectedresult: false
+    object: version-stable
+    not:
+      any:
+        - exactmatch:
+            value: 2.1.0
+        - regexp:
+            value: -beta
+  - test: combinator4
+    expecterror: true
+    object: version-stable
+    any:
+      - regexp:
+          value: "2"
+      - numeric:
+          operation: ">"
+          value: "1"
+`
+
+func TestCombinatorPolicy(t *testing.T) {
+	a := genericTestExec(t, combinatorPolicyDoc)
+	tr, err := a.GetResults("combinator0")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(tr.Results) != 1 {
+		t.Fatalf("combinator0: expected 1 sub-result, got %v", len(tr.Results))
+	}
+	sr := tr.Results[0]
+	expect := "(2.1.0 >= 2.0.0) && !(2.1.0 =~ -beta)"
+	if sr.Evaluator != "all" || sr.Expression != expect {
+		t.Fatalf("combinator0: unexpected evidence %v: %v", sr.Evaluator, sr.Expression)
+	}
+}
+
+func TestCombinatorValidation(t *testing.T) {
+	invalid := []string{
+		`"all": [{}]`,
+		`"any": [{"regexp": {"value": "a"}, "exactmatch": {"value": "b"}}]`,
+		`"not": {"numeric": {"operation": "<", "value": "x"}}`,
+		`"all": [{"not": {"any": [{"semver": {"constraint": "^1.x"}}]}}]`,
+	}
+	for _, x := range invalid {
+		doc := `{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "1"}]}}],
+		"tests": [{"test": "t", "object": "o", ` + x + `}]}`
+		_, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err == nil {
+			t.Fatalf("LoadDocument: expected error for %v", x)
+		}
+	}
+}
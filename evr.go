@@ -9,30 +9,153 @@ package scribe
 
 import (
 	"fmt"
+	"strings"
 )
 
 // EVRTest describes the EVR option that will be performed as part of a test.
 // For example, Operation may be "<" and Value may be a version string such as
-// "1.2.3".
+// "1.2.3". Supported operations are "<", "<=", ">", ">=", "=" and "!=".
+//
+// As an alternative to Operation and Value, Ranges can contain a list of
+// version ranges. In this case the comparison is true if the version falls
+// within any of the ranges, which can be used to describe the set of versions
+// affected by a vulnerability.
+//
+// Scheme optionally selects the algorithm used to compare versions, and can be
+// one of "rpm", "dpkg" or "semver". If it is not set, the algorithm is chosen
+// based on the type of package the object returned, with rpm comparison being
+// used if the type is unknown.
 type EVRTest struct {
-	Operation string `json:"operation,omitempty" yaml:"operation,omitempty"`
-	Value     string `json:"value,omitempty" yaml:"value,omitempty"`
+	Operation string     `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Value     string     `json:"value,omitempty" yaml:"value,omitempty"`
+	Ranges    []EVRRange `json:"ranges,omitempty" yaml:"ranges,omitempty"`
+	Scheme    string     `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+}
+
+// EVRRange describes a range of versions. Lower and Upper are the bounds of the
+// range; if either is empty the range is unbounded in that direction. By
+// default the bounds are exclusive, LowerInclusive and UpperInclusive can be
+// used to include the bound in the range. For example, "affected from 1.2 up
+// to but not including 1.4" would be a Lower of 1.2 with LowerInclusive set,
+// and an Upper of 1.4.
+type EVRRange struct {
+	Lower          string `json:"lower,omitempty" yaml:"lower,omitempty"`
+	LowerInclusive bool   `json:"lowerinclusive,omitempty" yaml:"lowerinclusive,omitempty"`
+	Upper          string `json:"upper,omitempty" yaml:"upper,omitempty"`
+	UpperInclusive bool   `json:"upperinclusive,omitempty" yaml:"upperinclusive,omitempty"`
+}
+
+// String returns the range in interval notation, e.g. [1.2, 1.4).
+func (r EVRRange) String() string {
+	ret := "("
+	if r.LowerInclusive {
+		ret = "["
+	}
+	ret += r.Lower + ", " + r.Upper
+	if r.UpperInclusive {
+		return ret + "]"
+	}
+	return ret + ")"
+}
+
+// contains returns true if version v falls within the range.
+func (r EVRRange) contains(d *Document, scheme string, v string) (bool, error) {
+	if r.Lower != "" {
+		op := EvropGreaterThan
+		if r.LowerInclusive {
+			op = EvropGreaterThanOrEqual
+		}
+		f, err := evrCompareScheme(d, scheme, op, v, r.Lower)
+		if err != nil || !f {
+			return false, err
+		}
+	}
+	if r.Upper != "" {
+		op := EvropLessThan
+		if r.UpperInclusive {
+			op = EvropLessThanOrEqual
+		}
+		f, err := evrCompareScheme(d, scheme, op, v, r.Upper)
+		if err != nil || !f {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// isSet returns true if the test has been configured with an EVR comparison.
+func (e *EVRTest) isSet() bool {
+	return e.Value != "" || len(e.Ranges) > 0
 }
 
-func (e *EVRTest) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
-	debugPrint("evaluate(): evr %v \"%v\", %v \"%v\"\n", c.identifier, c.testValue, e.Operation, e.Value)
+func (e *EVRTest) validate() error {
+	if e.Scheme != "" && !evrValidScheme(e.Scheme) {
+		return fmt.Errorf("invalid evr scheme %v", e.Scheme)
+	}
+	if len(e.Ranges) > 0 {
+		if e.Value != "" || e.Operation != "" {
+			return fmt.Errorf("evr ranges cannot be combined with operation and value")
+		}
+		for _, x := range e.Ranges {
+			if x.Lower == "" && x.Upper == "" {
+				return fmt.Errorf("evr range must have a lower or upper bound")
+			}
+		}
+	}
+	return nil
+}
+
+// scheme returns the comparison scheme to use for criteria c.
+func (e *EVRTest) scheme(c evaluationCriteria) string {
+	if e.Scheme != "" {
+		return e.Scheme
+	}
+	return evrSchemeForType(c.pkgtype)
+}
+
+func (e *EVRTest) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
+	if len(e.Ranges) > 0 {
+		return e.evaluateRanges(d, c)
+	}
+	d.debugPrint("evaluate(): evr %v \"%v\", %v \"%v\"\n", c.identifier, c.testValue, e.Operation, e.Value)
 	evrop := evrLookupOperation(e.Operation)
 	if evrop == EvropUnknown {
 		return ret, fmt.Errorf("invalid evr operation %v", e.Operation)
 	}
 	ret.criteria = c
-	result, err := evrCompare(evrop, c.testValue, e.Value)
+	ret.evaluator = "evr"
+	ret.expression = fmt.Sprintf("%v %v %v", c.testValue, e.Operation, e.Value)
+	result, err := evrCompareScheme(d, e.scheme(c), evrop, c.testValue, e.Value)
 	if err != nil {
 		return ret, err
 	}
 	if result {
-		debugPrint("evaluate(): evr comparison operation was true\n")
+		d.debugPrint("evaluate(): evr comparison operation was true\n")
 		ret.result = true
 	}
 	return ret, nil
 }
+
+func (e *EVRTest) evaluateRanges(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
+	rs := make([]string, 0)
+	for _, x := range e.Ranges {
+		rs = append(rs, x.String())
+	}
+	d.debugPrint("evaluate(): evr %v \"%v\", ranges %v\n", c.identifier, c.testValue, strings.Join(rs, " "))
+	ret.criteria = c
+	ret.evaluator = "evr"
+	ret.expression = fmt.Sprintf("%v in %v", c.testValue, strings.Join(rs, " or "))
+	scheme := e.scheme(c)
+	for _, x := range e.Ranges {
+		f, err := x.contains(d, scheme, c.testValue)
+		if err != nil {
+			return ret, err
+		}
+		if f {
+			d.debugPrint("evaluate(): evr version within range %v\n", x)
+			ret.result = true
+			break
+		}
+	}
+	return ret, nil
+}
@@ -20,13 +20,25 @@ import (
 // series of tests but there are likely to be some edge cases and certain
 // scenarios it does not handle.
 
-// EVR operation constants
+// EVR operation constants. The values of the constants are part of the API,
+// so new operations must be added at the end.
 const (
 	_ = iota
 	EvropLessThan
 	EvropGreaterThan
 	EvropEquals
 	EvropUnknown
+	EvropLessThanOrEqual
+	EvropGreaterThanOrEqual
+	EvropNotEquals
+)
+
+// EVR comparison schemes, which select the algorithm used to compare
+// version strings.
+const (
+	EvrSchemeRpm    = "rpm"    // rpmvercmp() comparison.
+	EvrSchemeDpkg   = "dpkg"   // Debian verrevcmp() comparison.
+	EvrSchemeSemver = "semver" // Semantic versioning precedence.
 )
 
 type evr struct {
@@ -43,6 +55,12 @@ func evrLookupOperation(s string) int {
 		return EvropGreaterThan
 	case "=":
 		return EvropEquals
+	case "<=":
+		return EvropLessThanOrEqual
+	case ">=":
+		return EvropGreaterThanOrEqual
+	case "!=":
+		return EvropNotEquals
 	}
 	return EvropUnknown
 }
@@ -51,8 +69,16 @@ func evrOperationStr(val int) string {
 	switch val {
 	case EvropLessThan:
 		return "<"
+	case EvropGreaterThan:
+		return ">"
 	case EvropEquals:
 		return "="
+	case EvropLessThanOrEqual:
+		return "<="
+	case EvropGreaterThanOrEqual:
+		return ">="
+	case EvropNotEquals:
+		return "!="
 	default:
 		return "?"
 	}
@@ -70,7 +96,7 @@ func evrIsNumber(s string) bool {
 	return true
 }
 
-func evrExtract(s string) (evr, error) {
+func evrExtract(d *Document, s string) (evr, error) {
 	var ret evr
 	var idx int
 
@@ -116,7 +142,7 @@ func evrExtract(s string) (evr, error) {
 		ret.release = ""
 	}
 
-	debugPrint("evrExtract(): epoch=%v, version=%v, revision=%v\n", ret.epoch, ret.version, ret.release)
+	d.debugPrint("evrExtract(): epoch=%v, version=%v, revision=%v\n", ret.epoch, ret.version, ret.release)
 	return ret, nil
 }
 
@@ -264,21 +290,61 @@ func evrRpmCompare(actual evr, check evr) (int, error) {
 	return 0, nil
 }
 
-func evrCompare(op int, actual string, check string) (bool, error) {
-	debugPrint("evrCompare(): %v %v %v\n", actual, evrOperationStr(op), check)
-
-	evract, err := evrExtract(actual)
-	if err != nil {
-		return false, err
+// evrValidScheme returns true if s is a known comparison scheme.
+func evrValidScheme(s string) bool {
+	switch s {
+	case EvrSchemeRpm, EvrSchemeDpkg, EvrSchemeSemver:
+		return true
 	}
-	evrchk, err := evrExtract(check)
-	if err != nil {
-		return false, err
+	return false
+}
+
+// evrSchemeForType returns the comparison scheme that should be used for a
+// package of type pkgtype. The rpm scheme is used unless the package type is
+// known to use a different one.
+func evrSchemeForType(pkgtype string) string {
+	if pkgtype == "dpkg" {
+		return EvrSchemeDpkg
 	}
+	return EvrSchemeRpm
+}
 
-	ret, err := evrRpmCompare(evract, evrchk)
-	if err != nil {
-		return false, err
+func evrCompare(d *Document, op int, actual string, check string) (bool, error) {
+	return evrCompareScheme(d, EvrSchemeRpm, op, actual, check)
+}
+
+func evrCompareScheme(d *Document, scheme string, op int, actual string, check string) (bool, error) {
+	d.debugPrint("evrCompare(): %v %v %v (%v)\n", actual, evrOperationStr(op), check, scheme)
+
+	var ret int
+	switch scheme {
+	case EvrSchemeRpm:
+		evract, err := evrExtract(d, actual)
+		if err != nil {
+			return false, err
+		}
+		evrchk, err := evrExtract(d, check)
+		if err != nil {
+			return false, err
+		}
+		ret, err = evrRpmCompare(evract, evrchk)
+		if err != nil {
+			return false, err
+		}
+	case EvrSchemeDpkg:
+		var err error
+		ret, err = dpkgCompare(actual, check)
+		if err != nil {
+			return false, err
+		}
+	case EvrSchemeSemver:
+		var err error
+		ret, err = semverCompare(actual, check)
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("evrCompare: unknown scheme %v", scheme)
 	}
 	switch op {
 	case EvropEquals:
@@ -296,6 +362,21 @@ func evrCompare(op int, actual string, check string) (bool, error) {
 			return true, nil
 		}
 		return false, nil
+	case EvropLessThanOrEqual:
+		if ret != -1 {
+			return true, nil
+		}
+		return false, nil
+	case EvropGreaterThanOrEqual:
+		if ret != 1 {
+			return true, nil
+		}
+		return false, nil
+	case EvropNotEquals:
+		if ret != 0 {
+			return true, nil
+		}
+		return false, nil
 	}
 	return false, fmt.Errorf("evrCompare: unknown operator")
 }
@@ -305,5 +386,11 @@ func evrCompare(op int, actual string, check string) (bool, error) {
 // check are the version strings to test. Returns status of test evaluation, or an error
 // if an error occurs.
 func TestEvrCompare(op int, actual string, check string) (bool, error) {
-	return evrCompare(op, actual, check)
+	return evrCompare(nil, op, actual, check)
+}
+
+// TestEvrCompareScheme is the same as TestEvrCompare, but performs the
+// comparison using the specified scheme (e.g., EvrSchemeDpkg).
+func TestEvrCompareScheme(scheme string, op int, actual string, check string) (bool, error) {
+	return evrCompareScheme(nil, scheme, op, actual, check)
 }
@@ -61,6 +61,31 @@ var evrTests = []evrTestTable{
 	{"1241", "<", "14444"},
 	{"12412", ">", "50"},
 	{"51", ">", "50"},
+	{"1.5.9", "<=", "1.5.10"},
+	{"1.5.10", "<=", "1.5.10"},
+	{"1.5.10", ">=", "1.5.10"},
+	{"1:1.0", ">=", "2.0"},
+	{"1.0.1e", "!=", "1.0.1f"},
+	{"0:1.0.1e", "!=", "1:1.0.1e"},
+}
+
+func evrOpmode(t *testing.T, op string) int {
+	switch op {
+	case "=":
+		return scribe.EvropEquals
+	case "<":
+		return scribe.EvropLessThan
+	case ">":
+		return scribe.EvropGreaterThan
+	case "<=":
+		return scribe.EvropLessThanOrEqual
+	case ">=":
+		return scribe.EvropGreaterThanOrEqual
+	case "!=":
+		return scribe.EvropNotEquals
+	}
+	t.Fatalf("evr test has invalid operation %v", op)
+	return scribe.EvropUnknown
 }
 
 func TestEvrops(t *testing.T) {
@@ -68,18 +93,7 @@ func TestEvrops(t *testing.T) {
 	scribe.TestHooks(true)
 
 	for _, x := range evrTests {
-		var opmode int
-
-		switch x.op {
-		case "=":
-			opmode = scribe.EvropEquals
-		case "<":
-			opmode = scribe.EvropLessThan
-		case ">":
-			opmode = scribe.EvropGreaterThan
-		default:
-			t.Fatalf("evr test has invalid operation %v", x.op)
-		}
+		opmode := evrOpmode(t, x.op)
 		t.Logf("%v %v %v", x.verA, x.op, x.verB)
 		result, err := scribe.TestEvrCompare(opmode, x.verA, x.verB)
 		if err != nil {
@@ -90,3 +104,126 @@ func TestEvrops(t *testing.T) {
 		}
 	}
 }
+
+var dpkgEvrTests = []evrTestTable{
+	{"1.0.2g-1ubuntu4.10", "<", "1.0.2g-1ubuntu4.15~"},
+	{"1.0.2g-1ubuntu4.15~", "<", "1.0.2g-1ubuntu4.15"},
+	{"1.0~rc1", "<", "1.0"},
+	{"1.0~~", "<", "1.0~~a"},
+	{"1.0~~a", "<", "1.0~"},
+	{"1.0~", "<", "1.0"},
+	{"1.0", "<", "1.0a"},
+	{"1.0a", "<", "1.0+"},
+	{"1.0", "<", "1.0+dfsg"},
+	{"1.0-1", "<", "1.0-1.1"},
+	{"1.0-1ubuntu1", "<", "1.0-1ubuntu1.1"},
+	{"2.30-8", "<", "2.30-8+deb7u1"},
+	{"2.6.32-5", ">", "2.6.32-5~bpo60+1"},
+	{"1.0.1e-2+deb7u14", ">", "1.0.1e-2+deb7u9"},
+	{"7u65-2.5.1-2~deb7u1", "<", "7u65-2.5.1-2"},
+	{"1:0.1", ">", "2.0"},
+	{"0:1.0", "=", "1.0"},
+	{"1.2.3", "=", "1.2.03"},
+	{"1:9.9.5.dfsg-4.3", "=", "1:9.9.5.dfsg-4.3"},
+	{"1.2-3-4", ">", "1.2-3-3"},
+	{"a", "<", "b"},
+	{"1.10", ">", "1.9"},
+	{"1.0~rc1", "<=", "1.0"},
+	{"1.0", ">=", "1.0~rc1"},
+	{"1.0", "!=", "1.0~rc1"},
+}
+
+var semverEvrTests = []evrTestTable{
+	{"1.0.0-alpha", "<", "1.0.0-alpha.1"},
+	{"1.0.0-alpha.1", "<", "1.0.0-alpha.beta"},
+	{"1.0.0-alpha.beta", "<", "1.0.0-beta"},
+	{"1.0.0-beta", "<", "1.0.0-beta.2"},
+	{"1.0.0-beta.2", "<", "1.0.0-beta.11"},
+	{"1.0.0-beta.11", "<", "1.0.0-rc.1"},
+	{"1.0.0-rc.1", "<", "1.0.0"},
+	{"1.0.0+build.5", "=", "1.0.0"},
+	{"v1.2.3", "=", "1.2.3"},
+	{"1.10.0", ">", "1.9.0"},
+	{"2.0.0", ">", "1.99.99"},
+	{"1.2.4", ">", "1.2.3"},
+	{"1.2.3-rc.1", "<=", "1.2.3"},
+	{"1.2.3+build.1", ">=", "1.2.3"},
+	{"1.2.3-rc.1", "!=", "1.2.3"},
+}
+
+func TestEvrCompareScheme(t *testing.T) {
+	tables := []struct {
+		scheme string
+		tests  []evrTestTable
+	}{
+		{scribe.EvrSchemeRpm, evrTests},
+		{scribe.EvrSchemeDpkg, dpkgEvrTests},
+		{scribe.EvrSchemeSemver, semverEvrTests},
+	}
+	for _, tbl := range tables {
+		for _, x := range tbl.tests {
+			result, err := scribe.TestEvrCompareScheme(tbl.scheme, evrOpmode(t, x.op), x.verA, x.verB)
+			if err != nil {
+				t.Fatalf("%v: %v %v %v: %v", tbl.scheme, x.verA, x.op, x.verB, err)
+			}
+			if !result {
+				t.Fatalf("%v: failed %v %v %v", tbl.scheme, x.verA, x.op, x.verB)
+			}
+		}
+	}
+
+	// Operations that should be false.
+	falseTests := []evrTestTable{
+		{"1.5.10", "<=", "1.5.9"},
+		{"1.5.9", ">=", "1.5.10"},
+		{"1.5.9", "!=", "1.5.9"},
+		{"0:1.5.9", "!=", "1.5.9"},
+	}
+	for _, x := range falseTests {
+		result, err := scribe.TestEvrCompare(evrOpmode(t, x.op), x.verA, x.verB)
+		if err != nil {
+			t.Fatalf("scribe.TestEvrCompare: %v", err)
+		}
+		if result {
+			t.Fatalf("scribe.TestEvrCompare: %v %v %v should be false", x.verA, x.op, x.verB)
+		}
+	}
+
+	// The rpm and dpkg schemes disagree on how ~ is ordered.
+	result, err := scribe.TestEvrCompareScheme(scribe.EvrSchemeRpm, scribe.EvropLessThan, "1.0~rc1", "1.0")
+	if err != nil || result {
+		t.Fatalf("rpm: expected 1.0~rc1 < 1.0 to be false")
+	}
+
+	invalid := []struct {
+		scheme  string
+		version string
+	}{
+		{scribe.EvrSchemeDpkg, "1.0-"},
+		{scribe.EvrSchemeDpkg, "x:1.0"},
+		{scribe.EvrSchemeDpkg, "1:-1"},
+		{scribe.EvrSchemeSemver, "1.2"},
+		{scribe.EvrSchemeSemver, "01.2.3"},
+		{scribe.EvrSchemeSemver, "1.2.3-"},
+		{scribe.EvrSchemeSemver, "1.2.3-01"},
+		{scribe.EvrSchemeSemver, "1.2.x"},
+		{"bad", "1.2.3"},
+	}
+	for _, x := range invalid {
+		_, err := scribe.TestEvrCompareScheme(x.scheme, scribe.EvropEquals, x.version, "1.0.0")
+		if err == nil {
+			t.Fatalf("%v: expected error for %v", x.scheme, x.version)
+		}
+	}
+}
+
+func TestEvrOperationValues(t *testing.T) {
+	ops := []int{scribe.EvropLessThan, scribe.EvropGreaterThan, scribe.EvropEquals,
+		scribe.EvropUnknown, scribe.EvropLessThanOrEqual, scribe.EvropGreaterThanOrEqual,
+		scribe.EvropNotEquals}
+	for i, x := range ops {
+		if x != i+1 {
+			t.Fatalf("EVR operation %v has value %v, expected %v", i, x, i+1)
+		}
+	}
+}
@@ -7,15 +7,21 @@
 
 package scribe
 
+import (
+	"fmt"
+)
+
 // ExactMatch is used to indicate a test should match Value exactly against
 // the referenced object
 type ExactMatch struct {
 	Value string `json:"value,omitempty" yaml:"value,omitempty"`
 }
 
-func (e *ExactMatch) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
-	debugPrint("evaluate(): exactmatch %v \"%v\", \"%v\"\n", c.identifier, c.testValue, e.Value)
+func (e *ExactMatch) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
+	d.debugPrint("evaluate(): exactmatch %v \"%v\", \"%v\"\n", c.identifier, c.testValue, e.Value)
 	ret.criteria = c
+	ret.evaluator = "exactmatch"
+	ret.expression = fmt.Sprintf("%v == %v", c.testValue, e.Value)
 	if c.testValue == e.Value {
 		ret.result = true
 	}
@@ -9,17 +9,17 @@ package scribe
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path"
-	"path/filepath"
 	"regexp"
 )
 
 // FileContent is used to perform tests against the content of a given file
-// on the file system.
+// on the file system. Locator options can be included to control how the file
+// system is searched.
 type FileContent struct {
 	Path       string `json:"path,omitempty" yaml:"path,omitempty"`
 	File       string `json:"file,omitempty" yaml:"file,omitempty"`
@@ -28,6 +28,8 @@ type FileContent struct {
 
 	ImportChain []string `json:"import-chain,omitempty" yaml:"import-chain,omitempty"`
 
+	LocatorOptions `yaml:",inline"`
+
 	matches []contentMatch
 }
 
@@ -39,6 +41,7 @@ type contentMatch struct {
 type matchLine struct {
 	fullmatch string
 	groups    []string
+	lineno    int // The line number of the match in the file.
 }
 
 func (f *FileContent) validate(d *Document) error {
@@ -63,14 +66,14 @@ func (f *FileContent) validate(d *Document) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return f.LocatorOptions.validate()
 }
 
-func (f *FileContent) fireChains(d *Document) ([]evaluationCriteria, error) {
+func (f *FileContent) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
 	if len(f.ImportChain) == 0 {
 		return nil, nil
 	}
-	debugPrint("fireChains(): firing chains for filecontent object\n")
+	d.debugPrint("fireChains(): firing chains for filecontent object\n")
 	uids := make([]string, 0)
 	for _, x := range f.matches {
 		found := false
@@ -88,7 +91,7 @@ func (f *FileContent) fireChains(d *Document) ([]evaluationCriteria, error) {
 	ret := make([]evaluationCriteria, 0)
 	for _, x := range uids {
 		varlist := make([]Variable, 0)
-		debugPrint("fireChains(): run for \"%v\"\n", x)
+		d.debugPrint("fireChains(): run for \"%v\"\n", x)
 
 		// Build our variable list for the filecontent chain import.
 		dirent, _ := path.Split(x)
@@ -98,12 +101,12 @@ func (f *FileContent) fireChains(d *Document) ([]evaluationCriteria, error) {
 		// Execute each chain entry in order for each identifier.
 		for _, y := range f.ImportChain {
 			oc, _ := d.getObjectInterfaceCopy(y)
-			oc.expandVariables(varlist)
-			err := oc.prepare()
+			oc.expandVariables(d, varlist)
+			err := oc.prepare(ctx, d)
 			if err != nil {
 				return nil, err
 			}
-			criteria, err := oc.fireChains(d)
+			criteria, err := oc.fireChains(ctx, d)
 			if err != nil {
 				return nil, err
 			}
@@ -113,9 +116,12 @@ func (f *FileContent) fireChains(d *Document) ([]evaluationCriteria, error) {
 
 			// Extract the criteria. Rewrite the identifier based
 			// on what identifier was used for the chain.
-			excri := oc.getCriteria()
+			excri := oc.getCriteria(d)
 			for _, z := range excri {
+				// The line number refers to the chained file,
+				// not the identifier, so it is dropped.
 				z.identifier = x
+				z.line = 0
 				ret = append(ret, z)
 			}
 		}
@@ -142,43 +148,51 @@ func (f *FileContent) isChain() bool {
 	return false
 }
 
-func (f *FileContent) expandVariables(v []Variable) {
-	f.Path = variableExpansion(v, f.Path)
-	f.File = variableExpansion(v, f.File)
+func (f *FileContent) expandVariables(d *Document, v []Variable) {
+	f.Path = variableExpansion(d, v, f.Path)
+	f.File = variableExpansion(d, v, f.File)
 }
 
-func (f *FileContent) getCriteria() (ret []evaluationCriteria) {
+func (f *FileContent) getCriteria(d *Document) (ret []evaluationCriteria) {
 	for _, x := range f.matches {
 		for _, y := range x.matches {
 			for _, z := range y.groups {
 				n := evaluationCriteria{}
 				n.identifier = x.path
 				n.testValue = z
+				n.line = y.lineno
 				ret = append(ret, n)
 			}
 		}
 	}
 	if len(f.Concat) != 0 {
-		return criteriaConcat(ret, f.Concat)
+		return criteriaConcat(d, ret, f.Concat)
 	}
 	return ret
 }
 
-func (f *FileContent) prepare() error {
-	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
+func (f *FileContent) prepare(ctx context.Context, d *Document) error {
+	d.debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
 
-	sfl := newSimpleFileLocator()
+	sfl := newSimpleFileLocator(d)
 	sfl.root = f.Path
-	err := sfl.locate(f.File, true)
+	err := sfl.setOptions(f.LocatorOptions)
+	if err != nil {
+		return err
+	}
+	err = sfl.locate(ctx, f.File, true)
 	if err != nil {
 		return err
 	}
+	d.addWarnings(sfl.warnings)
 
 	for _, x := range sfl.matches {
-		m, err := fileContentCheck(x, f.Expression)
-		// XXX These soft errors during preparation are ignored right
-		// now, but they should probably be tracked somewhere.
+		m, err := fileContentCheck(ctx, d, x, f.Expression)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			d.warn(x, err)
 			continue
 		}
 		if m == nil || len(m) == 0 {
@@ -189,11 +203,11 @@ func (f *FileContent) prepare() error {
 		ncm.path = x
 		ncm.matches = m
 		f.matches = append(f.matches, ncm)
-		debugPrint("prepare(): content matches in %v\n", ncm.path)
+		d.debugPrint("prepare(): content matches in %v\n", ncm.path)
 		for _, i := range ncm.matches {
-			debugPrint("prepare(): full match: \"%v\"\n", i.fullmatch)
+			d.debugPrint("prepare(): full match (line %v): \"%v\"\n", i.lineno, i.fullmatch)
 			for j := range i.groups {
-				debugPrint("prepare(): group %v: \"%v\"\n", j, i.groups[j])
+				d.debugPrint("prepare(): group %v: \"%v\"\n", j, i.groups[j])
 			}
 		}
 	}
@@ -201,144 +215,55 @@ func (f *FileContent) prepare() error {
 	return nil
 }
 
-type simpleFileLocator struct {
-	executed bool
-	root     string
-	curDepth int
-	maxDepth int
-	matches  []string
-	locator  func(string, bool, string, int) ([]string, error)
-}
-
-func newSimpleFileLocator() (ret simpleFileLocator) {
-	// XXX This needs to be fixed to work with Windows.
-	ret.root = "/"
-	ret.maxDepth = 10
-	ret.matches = make([]string, 0)
-	if sRuntime.fileLocator != nil {
-		ret.locator = sRuntime.fileLocator
-	}
-	return ret
-}
-
-func (s *simpleFileLocator) locate(target string, useRegexp bool) error {
-	if s.executed {
-		return fmt.Errorf("locator has already been executed")
-	}
-	s.executed = true
-	if s.locator != nil {
-		buf, err := s.locator(target, useRegexp, s.root, s.maxDepth)
-		if err != nil {
-			return err
-		}
-		s.matches = buf
-		return nil
-	}
-	return s.locateInner(target, useRegexp, "")
-}
-
-func (s *simpleFileLocator) symFollowIsRegular(path string) (bool, error) {
-	fi, err := os.Stat(path)
+func fileContentCheck(ctx context.Context, d *Document, path string, regex string) ([]matchLine, error) {
+	re, err := regexp.Compile(regex)
 	if err != nil {
-		return false, err
-	}
-	if fi.Mode().IsRegular() {
-		return true, nil
+		return nil, err
 	}
-	return false, nil
-}
-
-func (s *simpleFileLocator) locateInner(target string, useRegexp bool, path string) error {
-	var (
-		spath string
-		re    *regexp.Regexp
-		err   error
-	)
-
-	// If processing this directory would result in us exceeding the
-	// specified search depth, just ignore it.
-	if (s.curDepth + 1) > s.maxDepth {
-		return nil
+	ret := make([]matchLine, 0)
+	lineno := 0
+	if d.object != nil {
+		d.object.stats.filesRead++
 	}
-
-	if useRegexp {
-		re, err = regexp.Compile(target)
-		if err != nil {
-			return err
+	err = d.fsIndex.scanLines(ctx, path, func(ln string) {
+		lineno++
+		mtch := re.FindStringSubmatch(ln)
+		if len(mtch) > 0 {
+			newmatch := matchLine{}
+			newmatch.groups = make([]string, 0)
+			newmatch.fullmatch = mtch[0]
+			newmatch.lineno = lineno
+			for i := 1; i < len(mtch); i++ {
+				newmatch.groups = append(newmatch.groups, mtch[i])
+			}
+			ret = append(ret, newmatch)
 		}
-	}
-
-	s.curDepth++
-	defer func() {
-		s.curDepth--
-	}()
-
-	if path == "" {
-		spath = s.root
-	} else {
-		spath = path
-	}
-	dirents, err := ioutil.ReadDir(spath)
+	})
 	if err != nil {
-		// If we encounter an error while reading a directory, just
-		// ignore it and keep going until we are finished.
-		return nil
+		return nil, err
 	}
-	for _, x := range dirents {
-		fname := filepath.Join(spath, x.Name())
-		if x.IsDir() {
-			err = s.locateInner(target, useRegexp, fname)
-			if err != nil {
-				return err
-			}
-		} else if x.Mode().IsRegular() {
-			if !useRegexp {
-				if x.Name() == target {
-					s.matches = append(s.matches, fname)
-				}
-			} else {
-				if re.MatchString(x.Name()) {
-					s.matches = append(s.matches, fname)
-				}
-			}
-		} else if (x.Mode() & os.ModeSymlink) > 0 {
-			isregsym, err := s.symFollowIsRegular(fname)
-			if err != nil {
-				// Ignore these errors and continue searching
-				return nil
-			}
-			if isregsym {
-				if !useRegexp {
-					if x.Name() == target {
-						s.matches = append(s.matches, fname)
-					}
-				} else {
-					if re.MatchString(x.Name()) {
-						s.matches = append(s.matches, fname)
-					}
-				}
-			}
-		}
+
+	if len(ret) == 0 {
+		return nil, nil
 	}
-	return nil
+	return ret, nil
 }
 
-func fileContentCheck(path string, regex string) ([]matchLine, error) {
-	re, err := regexp.Compile(regex)
-	if err != nil {
-		return nil, err
-	}
+// scanFileLines reads the file at path, calling f for each line in the file.
+func scanFileLines(ctx context.Context, path string, f func(string)) error {
 	fd, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer func() {
 		fd.Close()
 	}()
 
 	rdr := bufio.NewReader(fd)
-	ret := make([]matchLine, 0)
 	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		// XXX Ignore potential partial reads (prefix) here, for lines
 		// with excessive length we will just treat it as multiple
 		// lines
@@ -347,24 +272,10 @@ func fileContentCheck(path string, regex string) ([]matchLine, error) {
 			if err == io.EOF {
 				break
 			} else {
-				return nil, err
-			}
-		}
-		ln := string(buf)
-		mtch := re.FindStringSubmatch(ln)
-		if len(mtch) > 0 {
-			newmatch := matchLine{}
-			newmatch.groups = make([]string, 0)
-			newmatch.fullmatch = mtch[0]
-			for i := 1; i < len(mtch); i++ {
-				newmatch.groups = append(newmatch.groups, mtch[i])
+				return err
 			}
-			ret = append(ret, newmatch)
 		}
+		f(string(buf))
 	}
-
-	if len(ret) == 0 {
-		return nil, nil
-	}
-	return ret, nil
+	return nil
 }
@@ -0,0 +1,194 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+)
+
+// The default maximum size of a file that will be hashed by a FileHash
+// object.
+const defaultFileHashMaxSize = 100 * 1024 * 1024
+
+// FileHash is used to perform tests against the cryptographic digest of files
+// on the file system, for example to verify a file matches a known good
+// version. Locator options can be included to control how the file system is
+// searched.
+//
+// Algorithm selects the digest algorithm and can be sha256, sha512 or sha1; if
+// unset, sha256 is used. The digest is returned as a lower case hex string.
+//
+// MaxSize is the largest file in bytes that will be hashed, and defaults to
+// 100 MiB. Unlike the maxfilesize locator option, which silently ignores
+// larger files, a located file exceeding MaxSize is reported as a warning.
+type FileHash struct {
+	Path      string `json:"path,omitempty" yaml:"path,omitempty"`
+	File      string `json:"file,omitempty" yaml:"file,omitempty"`
+	Algorithm string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	MaxSize   int64  `json:"maxsize,omitempty" yaml:"maxsize,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	matches []hashMatch
+}
+
+type hashMatch struct {
+	path   string
+	digest string
+}
+
+func (f *FileHash) isChain() bool {
+	return false
+}
+
+func (f *FileHash) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (f *FileHash) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (f *FileHash) validate(d *Document) error {
+	if len(f.Path) == 0 {
+		return fmt.Errorf("filehash path must be set")
+	}
+	if len(f.File) == 0 {
+		return fmt.Errorf("filehash file must be set")
+	}
+	_, err := regexp.Compile(f.File)
+	if err != nil {
+		return err
+	}
+	if f.newHash() == nil {
+		return fmt.Errorf("filehash algorithm %v is not valid", f.Algorithm)
+	}
+	if f.MaxSize < 0 {
+		return fmt.Errorf("filehash maxsize cannot be negative")
+	}
+	return f.LocatorOptions.validate()
+}
+
+func (f *FileHash) expandVariables(d *Document, v []Variable) {
+	f.Path = variableExpansion(d, v, f.Path)
+	f.File = variableExpansion(d, v, f.File)
+}
+
+func (f *FileHash) getCriteria(d *Document) (ret []evaluationCriteria) {
+	for _, x := range f.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.digest
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+// newHash returns a new hash for the configured algorithm, or nil if the
+// algorithm is not valid.
+func (f *FileHash) newHash() hash.Hash {
+	switch f.Algorithm {
+	case "", "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	case "sha1":
+		return sha1.New()
+	}
+	return nil
+}
+
+func (f *FileHash) maxSize() int64 {
+	if f.MaxSize == 0 {
+		return defaultFileHashMaxSize
+	}
+	return f.MaxSize
+}
+
+func (f *FileHash) prepare(ctx context.Context, d *Document) error {
+	d.debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
+
+	sfl := newSimpleFileLocator(d)
+	sfl.root = f.Path
+	err := sfl.setOptions(f.LocatorOptions)
+	if err != nil {
+		return err
+	}
+	err = sfl.locate(ctx, f.File, true)
+	if err != nil {
+		return err
+	}
+	d.addWarnings(sfl.warnings)
+
+	for _, x := range sfl.matches {
+		digest, err := f.hashFile(ctx, d, x)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			d.warn(x, err)
+			continue
+		}
+		d.debugPrint("prepare(): %v digest %v\n", x, digest)
+		f.matches = append(f.matches, hashMatch{path: x, digest: digest})
+	}
+
+	return nil
+}
+
+// hashFile returns the hex encoded digest of the file at path.
+func (f *FileHash) hashFile(ctx context.Context, d *Document, path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() > f.maxSize() {
+		return "", fmt.Errorf("file size %v exceeds filehash maxsize %v", fi.Size(), f.maxSize())
+	}
+	if d.object != nil {
+		d.object.stats.filesRead++
+	}
+	h := f.newHash()
+	// Limit the read in case the file grows while it is being hashed; if
+	// more than the maximum size can be read the file is rejected.
+	n, err := io.Copy(h, &contextReader{ctx: ctx, r: io.LimitReader(fd, f.maxSize()+1)})
+	if err != nil {
+		return "", err
+	}
+	if n > f.maxSize() {
+		return "", fmt.Errorf("file size exceeds filehash maxsize %v", f.maxSize())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contextReader is a reader that fails once ctx has been cancelled, so long
+// reads can be interrupted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if c.ctx.Err() != nil {
+		return 0, c.ctx.Err()
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,225 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The maximum size of a file for which content will be kept in the file index.
+// Larger files are read from disk each time they are examined.
+const fileIndexMaxContent = 1024 * 1024
+
+// The default maximum total size of the file content kept in the file index,
+// see WithFileCacheSize.
+const fileIndexDefaultCacheSize = 64 * 1024 * 1024
+
+// fileIndex is a cache of file system information shared by all objects
+// during the analysis of a document. Each directory tree is only walked once
+// for a given root and search depth, and the content of a file is only read
+// once regardless of how many objects examine it.
+//
+// The total size of the file content kept in the index is limited by the file
+// cache size of the engine. If adding the content of a file would exceed the
+// limit, the content that was least recently used is discarded, and will be
+// read from disk again if it is needed.
+//
+// Entries are populated by the first object that requests them; any other
+// objects requesting the same entry while this is in progress wait for the
+// result. If populating an entry fails because the context of the requesting
+// object was cancelled, the entry is discarded so another object can try
+// again.
+type fileIndex struct {
+	sync.Mutex
+	d        *Document
+	walks    map[string]*fileIndexEntry // Keyed by locator options and root.
+	contents map[string]*fileIndexEntry // Keyed by file path.
+	stats    fileIndexStats
+
+	maxContent  int64      // The maximum total size of file content.
+	contentSize int64      // The total size of file content in contents.
+	contentLRU  *list.List // Paths in contents, most recently used first.
+}
+
+type fileIndexEntry struct {
+	done     chan struct{}
+	value    []string        // Files found by a walk, or lines read from a file.
+	warnings []objectWarning // Soft errors encountered populating the entry.
+	err      error
+
+	size int64         // The size of the lines read from a file.
+	elem *list.Element // The element for a file in contentLRU.
+}
+
+func newFileIndex(d *Document) *fileIndex {
+	return &fileIndex{
+		d:          d,
+		walks:      make(map[string]*fileIndexEntry),
+		contents:   make(map[string]*fileIndexEntry),
+		maxContent: d.getEngine().fileCacheSize,
+		contentLRU: list.New(),
+	}
+}
+
+// lookup returns the entry for key in m, calling fill to populate the entry
+// if it is not already present.
+func (fi *fileIndex) lookup(ctx context.Context, m map[string]*fileIndexEntry, key string,
+	fill func(*fileIndexEntry) error) (*fileIndexEntry, error) {
+	for {
+		fi.Lock()
+		ent, ok := m[key]
+		if !ok {
+			ent = &fileIndexEntry{done: make(chan struct{})}
+			m[key] = ent
+			fi.Unlock()
+			ent.err = fill(ent)
+			if ctx.Err() != nil {
+				fi.Lock()
+				if m[key] == ent {
+					delete(m, key)
+				}
+				fi.Unlock()
+			}
+			close(ent.done)
+			return ent, ent.err
+		}
+		fi.Unlock()
+		select {
+		case <-ent.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// If the entry was discarded while we were waiting, another
+		// object may already have added a replacement; in either case
+		// the result of the entry we waited on can not be used.
+		fi.Lock()
+		cur, ok := m[key]
+		fi.Unlock()
+		if !ok || cur != ent {
+			continue
+		}
+		return ent, ent.err
+	}
+}
+
+// walk returns all regular files (or symlinks to regular files) found under
+// root, using locator options opts. Any warnings encountered during the walk
+// are also returned.
+func (fi *fileIndex) walk(ctx context.Context, root string, opts LocatorOptions) ([]string, []objectWarning, error) {
+	root = filepath.Clean(root)
+	key := opts.key() + ":" + root
+	ent, err := fi.lookup(ctx, fi.walks, key, func(ent *fileIndexEntry) error {
+		fi.d.debugPrint("fileIndex: walking %v, depth %v\n", root, opts.MaxDepth)
+		sfl := simpleFileLocator{root: root}
+		err := sfl.setOptions(opts)
+		if err != nil {
+			return err
+		}
+		// An empty expression matches any file name.
+		err = sfl.locateRoot(ctx, "", true)
+		ent.value = sfl.matches
+		ent.warnings = sfl.warnings
+		fi.Lock()
+		fi.stats.walks++
+		fi.stats.filesWalked += len(sfl.matches)
+		fi.Unlock()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ent.value, ent.warnings, nil
+}
+
+// scanLines calls f for each line in the file at path. The content of files
+// that are no larger than fileIndexMaxContent is kept in the index, subject to
+// the file cache size of the engine. If fi is nil, the file is always read
+// from disk.
+func (fi *fileIndex) scanLines(ctx context.Context, path string, f func(string)) error {
+	if fi == nil {
+		return scanFileLines(ctx, path, f)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.maxContent == 0 || st.Size() > fileIndexMaxContent || st.Size() > fi.maxContent {
+		fi.countRead(false)
+		return scanFileLines(ctx, path, f)
+	}
+	filled := false
+	ent, err := fi.lookup(ctx, fi.contents, path, func(ent *fileIndexEntry) error {
+		fi.d.debugPrint("fileIndex: reading %v\n", path)
+		filled = true
+		ent.value = make([]string, 0)
+		return scanFileLines(ctx, path, func(ln string) {
+			ent.value = append(ent.value, ln)
+			ent.size += int64(len(ln))
+		})
+	})
+	if err != nil {
+		return err
+	}
+	fi.countRead(!filled)
+	fi.useContent(path, ent, filled)
+	for _, x := range ent.value {
+		f(x)
+	}
+	return nil
+}
+
+// useContent records that ent, the content entry for path, has been used. If
+// the content was just read it is added to the total size of the content in
+// the index, and the least recently used content is discarded until the total
+// is within the limit.
+func (fi *fileIndex) useContent(path string, ent *fileIndexEntry, added bool) {
+	fi.Lock()
+	defer fi.Unlock()
+	if fi.contents[path] != ent {
+		return
+	}
+	if !added {
+		if ent.elem != nil {
+			fi.contentLRU.MoveToFront(ent.elem)
+		}
+		return
+	}
+	ent.elem = fi.contentLRU.PushFront(path)
+	fi.contentSize += ent.size
+	for fi.contentSize > fi.maxContent {
+		last := fi.contentLRU.Back()
+		key := last.Value.(string)
+		fi.contentLRU.Remove(last)
+		fi.contentSize -= fi.contents[key].size
+		delete(fi.contents, key)
+		fi.d.debugPrint("fileIndex: discarding %v\n", key)
+	}
+}
+
+// countRead records a file read, which was either satisfied from the index
+// or read from disk.
+func (fi *fileIndex) countRead(hit bool) {
+	fi.Lock()
+	defer fi.Unlock()
+	if hit {
+		fi.stats.cacheHits++
+	} else {
+		fi.stats.filesRead++
+	}
+}
+
+// getStats returns the file system activity recorded by the index.
+func (fi *fileIndex) getStats() fileIndexStats {
+	fi.Lock()
+	defer fi.Unlock()
+	return fi.stats
+}
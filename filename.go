@@ -8,17 +8,21 @@
 package scribe
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"regexp"
 )
 
 // FileName is used to perform tests against a given file name on
-// the file system
+// the file system. Locator options can be included to control how the file
+// system is searched.
 type FileName struct {
 	Path string `json:"path,omitempty" yaml:"path,omitempty"`
 	File string `json:"file,omitempty" yaml:"file,omitempty"`
 
+	LocatorOptions `yaml:",inline"`
+
 	matches []nameMatch
 }
 
@@ -31,7 +35,7 @@ func (f *FileName) isChain() bool {
 	return false
 }
 
-func (f *FileName) fireChains(d *Document) ([]evaluationCriteria, error) {
+func (f *FileName) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
 	return nil, nil
 }
 
@@ -45,14 +49,14 @@ func (f *FileName) validate(d *Document) error {
 	if len(f.File) == 0 {
 		return fmt.Errorf("filename file must be set")
 	}
-	return nil
+	return f.LocatorOptions.validate()
 }
 
-func (f *FileName) expandVariables(v []Variable) {
-	f.Path = variableExpansion(v, f.Path)
+func (f *FileName) expandVariables(d *Document, v []Variable) {
+	f.Path = variableExpansion(d, v, f.Path)
 }
 
-func (f *FileName) getCriteria() (ret []evaluationCriteria) {
+func (f *FileName) getCriteria(d *Document) (ret []evaluationCriteria) {
 	for _, x := range f.matches {
 		n := evaluationCriteria{}
 		n.identifier = x.path
@@ -62,15 +66,20 @@ func (f *FileName) getCriteria() (ret []evaluationCriteria) {
 	return ret
 }
 
-func (f *FileName) prepare() error {
-	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
+func (f *FileName) prepare(ctx context.Context, d *Document) error {
+	d.debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
 
-	sfl := newSimpleFileLocator()
+	sfl := newSimpleFileLocator(d)
 	sfl.root = f.Path
-	err := sfl.locate(f.File, true)
+	err := sfl.setOptions(f.LocatorOptions)
+	if err != nil {
+		return err
+	}
+	err = sfl.locate(ctx, f.File, true)
 	if err != nil {
 		return err
 	}
+	d.addWarnings(sfl.warnings)
 
 	re, err := regexp.Compile(f.File)
 	if err != nil {
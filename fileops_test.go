@@ -8,7 +8,16 @@
 package scribe_test
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/mozilla/scribe"
 )
 
 // Used in TestHasLinePolicy
@@ -313,3 +322,716 @@ var fileNamePolicyDoc = `
 func TestFileNamePolicy(t *testing.T) {
 	genericTestExec(t, fileNamePolicyDoc)
 }
+
+func TestFileIndexSharing(t *testing.T) {
+	var buf bytes.Buffer
+	e := scribe.NewEngine(scribe.WithTestHooks(true), scribe.WithDebug(&buf))
+	doc, err := e.LoadDocument(strings.NewReader(fileContentPolicyDoc))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	err = e.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("Engine.AnalyzeDocument: %v", err)
+	}
+	// All objects in the document share the same root, so the file
+	// system should only have been walked once, and each file should
+	// only have been read once.
+	walks := strings.Count(buf.String(), "fileIndex: walking")
+	if walks != 1 {
+		t.Fatalf("file system walked %v times", walks)
+	}
+	reads := strings.Count(buf.String(), "fileIndex: reading test/filecontent/testfile0\n")
+	if reads != 1 {
+		t.Fatalf("testfile0 read %v times", reads)
+	}
+}
+
+func TestFileCacheSize(t *testing.T) {
+	e := scribe.NewEngine(scribe.WithTestHooks(true))
+	doc, err := e.LoadDocument(strings.NewReader(fileContentPolicyDoc))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	a, err := e.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Engine.Analyze: %v", err)
+	}
+	expect := a.Results()
+
+	// The files in test/filecontent can not all be held in a cache this
+	// small, so content should be discarded and read again as needed, or
+	// never kept at all if the cache size is 0, without changing the
+	// results.
+	for _, size := range []int64{32, 0} {
+		var buf bytes.Buffer
+		e = scribe.NewEngine(scribe.WithTestHooks(true), scribe.WithDebug(&buf),
+			scribe.WithFileCacheSize(size))
+		a, err = e.Analyze(context.Background(), doc)
+		if err != nil {
+			t.Fatalf("Engine.Analyze: %v", err)
+		}
+		res := a.Results()
+		for i := range expect {
+			if res[i].MasterResult != expect[i].MasterResult ||
+				len(res[i].Results) != len(expect[i].Results) {
+				t.Fatalf("cache size %v: test %v has unexpected result %+v", size,
+					expect[i].TestID, res[i])
+			}
+		}
+		discards := strings.Count(buf.String(), "fileIndex: discarding")
+		reads := strings.Count(buf.String(), "fileIndex: reading")
+		if size != 0 && discards == 0 {
+			t.Fatalf("cache size %v: no content was discarded", size)
+		}
+		if size == 0 && reads != 0 {
+			t.Fatalf("cache size %v: content was kept in the index", size)
+		}
+	}
+}
+
+var warningsPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "txtfiles",
+		"filecontent": {
+			"path": "${root}",
+			"file": ".*\\.txt",
+			"expression": "(.*)"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "txtfiles0",
+		"object": "txtfiles",
+		"regexp": {
+			"value": "content"
+		}
+	}
+	]
+}
+`
+
+func TestPreparationWarnings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scribe")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "file0.txt"), []byte("content\n"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	// A symlink that refers to itself can not be followed, and should be
+	// reported as a warning rather than being silently ignored.
+	loop := filepath.Join(dir, "loop.txt")
+	err = os.Symlink(loop, loop)
+	if err != nil {
+		t.Fatalf("os.Symlink: %v", err)
+	}
+
+	for _, escalate := range []bool{false, true} {
+		doc, err := scribe.LoadDocument(strings.NewReader(warningsPolicyDoc))
+		if err != nil {
+			t.Fatalf("scribe.LoadDocument: %v", err)
+		}
+		doc.Variables = append(doc.Variables, scribe.Variable{Key: "root", Value: dir})
+		doc.Options.WarningsAsErrors = escalate
+		a, err := scribe.Analyze(context.Background(), doc)
+		if err != nil {
+			t.Fatalf("scribe.Analyze: %v", err)
+		}
+		res, err := a.GetResults("txtfiles0")
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if len(res.Warnings) != 1 || res.Warnings[0].Path != loop {
+			t.Fatalf("unexpected warnings %+v", res.Warnings)
+		}
+		if res.IsError != escalate {
+			t.Fatalf("test error status incorrect with escalation %v", escalate)
+		}
+		if !escalate && !res.MasterResult {
+			t.Fatalf("test should have been true")
+		}
+		found := false
+		for _, x := range res.SingleLineResults() {
+			if strings.HasPrefix(x, "warning ") && strings.Contains(x, loop) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("warning missing from single line results")
+		}
+		if !strings.Contains(res.String(), "[warning] "+loop) {
+			t.Fatalf("warning missing from human readable results")
+		}
+	}
+}
+
+// Used in TestUnrelatedWarnings
+var unrelatedWarningsPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "file0",
+		"filecontent": {
+			"path": "${root}",
+			"file": "^file0\\.txt$",
+			"expression": "(.*)"
+		}
+	},
+
+	{
+		"object": "datfiles",
+		"filename": {
+			"path": "${root}",
+			"file": "(.*)\\.dat$"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "file0",
+		"object": "file0",
+		"regexp": {
+			"value": "content"
+		}
+	},
+
+	{
+		"test": "datfiles",
+		"object": "datfiles"
+	}
+	]
+}
+`
+
+func TestUnrelatedWarnings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scribe")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "file0.txt"), []byte("content\n"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	loop := filepath.Join(dir, "loop.dat")
+	err = os.Symlink(loop, loop)
+	if err != nil {
+		t.Fatalf("os.Symlink: %v", err)
+	}
+
+	// Both objects share the walk of the directory, but the link that can
+	// not be followed should only be reported to the object that could
+	// have matched it.
+	doc, err := scribe.LoadDocument(strings.NewReader(unrelatedWarningsPolicyDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	doc.Variables = append(doc.Variables, scribe.Variable{Key: "root", Value: dir})
+	doc.Options.WarningsAsErrors = true
+	a, err := scribe.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("scribe.Analyze: %v", err)
+	}
+	res, err := a.GetResults("file0")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(res.Warnings) != 0 || res.IsError || !res.MasterResult {
+		t.Fatalf("file0: unexpected result %+v", res)
+	}
+	res, err = a.GetResults("datfiles")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0].Path != loop || !res.IsError {
+		t.Fatalf("datfiles: unexpected result %+v", res)
+	}
+
+	// If links to directories are followed, the link could have been a
+	// directory containing file0.txt, so it should be reported to both.
+	docstr := strings.Replace(unrelatedWarningsPolicyDoc, "\"path\": \"${root}\",",
+		"\"path\": \"${root}\", \"followsymlinks\": true,", -1)
+	doc, err = scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	doc.Variables = append(doc.Variables, scribe.Variable{Key: "root", Value: dir})
+	a, err = scribe.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("scribe.Analyze: %v", err)
+	}
+	for _, x := range []string{"file0", "datfiles"} {
+		res, err = a.GetResults(x)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if len(res.Warnings) != 1 || res.Warnings[0].Path != loop {
+			t.Fatalf("%v: unexpected warnings %+v", x, res.Warnings)
+		}
+	}
+}
+
+func TestFileContentEvidence(t *testing.T) {
+	a := genericTestExec(t, fileContentPolicyDoc)
+	res, err := a.GetResults("filecontent0")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(res.Results) != 1 {
+		t.Fatalf("filecontent0 has incorrect number of sub-results")
+	}
+	sr := res.Results[0]
+	if sr.Value != "0.5" || sr.Evaluator != "evr" || sr.Expression != "0.5 < 0.6" {
+		t.Fatalf("filecontent0 has incorrect evidence %+v", sr)
+	}
+	if sr.Line != 2 {
+		t.Fatalf("filecontent0 has incorrect line number %v", sr.Line)
+	}
+	if !strings.HasSuffix(res.SingleLineResults()[1], " line:2") {
+		t.Fatalf("line number missing from single line results")
+	}
+}
+
+var locatorOptionsPolicyDoc = `
+objects:
+  - object: default
+    filename:
+      path: ${root}
+      file: ^(.*\.txt)$
+  - object: shallow
+    filename:
+      path: ${root}
+      file: ^(.*\.txt)$
+      maxdepth: 2
+  - object: exclude
+    filename:
+      path: ${root}
+      file: ^(.*\.txt)$
+      exclude:
+        - /skip$
+  - object: smallfiles
+    filename:
+      path: ${root}
+      file: ^(.*\.txt)$
+      maxfilesize: 10
+  - object: symlinks
+    filename:
+      path: ${root}
+      file: ^(.*\.txt)$
+      followsymlinks: true
+      xdev: true
+tests:
+  - test: default
+    object: default
+  - test: shallow
+    object: shallow
+  - test: exclude
+    object: exclude
+  - test: smallfiles
+    object: smallfiles
+  - test: symlinks
+    object: symlinks
+`
+
+func TestLocatorOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scribe")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"top.txt":          "a file with some content",
+		"a/b/deep.txt":     "x",
+		"skip/skipped.txt": "x",
+	}
+	for k, v := range files {
+		p := filepath.Join(dir, k)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("os.MkdirAll: %v", err)
+		}
+		err = ioutil.WriteFile(p, []byte(v), 0644)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+	outside, err := ioutil.TempDir("", "scribe")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(outside)
+	err = ioutil.WriteFile(filepath.Join(outside, "linked.txt"), []byte("x"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	err = os.Symlink(outside, filepath.Join(dir, "link"))
+	if err != nil {
+		t.Fatalf("os.Symlink: %v", err)
+	}
+	// A link back to the root should not cause the tree to be walked
+	// again when following symlinks.
+	err = os.Symlink(dir, filepath.Join(dir, "a", "b", "loop"))
+	if err != nil {
+		t.Fatalf("os.Symlink: %v", err)
+	}
+
+	expected := map[string]int{
+		"default":    3,
+		"shallow":    2,
+		"exclude":    2,
+		"smallfiles": 2,
+		"symlinks":   4,
+	}
+	doc, err := scribe.LoadDocument(strings.NewReader(locatorOptionsPolicyDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	doc.Variables = append(doc.Variables, scribe.Variable{Key: "root", Value: dir})
+	a, err := scribe.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("scribe.Analyze: %v", err)
+	}
+	for k, v := range expected {
+		res, err := a.GetResults(k)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if len(res.Results) != v {
+			t.Fatalf("%v: expected %v files, got %v", k, v, len(res.Results))
+		}
+	}
+
+	// Make sure the options are passed through to an installed locator
+	var got scribe.LocatorOptions
+	e := scribe.NewEngine(scribe.WithFileLocator(func(target string, useRegexp bool,
+		root string, opts scribe.LocatorOptions) ([]string, error) {
+		if root == dir && target == "^(.*\\.txt)$" && opts.MaxFileSize == 10 {
+			got = opts
+		}
+		return nil, nil
+	}), scribe.WithParallelism(1))
+	doc, err = e.LoadDocument(strings.NewReader(locatorOptionsPolicyDoc))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	doc.Variables = append(doc.Variables, scribe.Variable{Key: "root", Value: dir})
+	err = e.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("Engine.AnalyzeDocument: %v", err)
+	}
+	if got.MaxDepth != 10 {
+		t.Fatalf("installed locator did not receive options")
+	}
+}
+
+func TestLocatorOptionsValidation(t *testing.T) {
+	for _, x := range []string{"maxdepth: -1", "maxfilesize: -1", "exclude: [\"(\"]"} {
+		docstr := "objects:\n  - object: obj\n    filename:\n      path: /\n      file: x\n      " + x + "\n"
+		_, err := scribe.LoadDocument(strings.NewReader(docstr))
+		if err == nil {
+			t.Fatalf("document with %v should not validate", x)
+		}
+	}
+}
+
+// Used in TestFileStatPolicy, ROOT and UID are replaced before the document
+// is loaded.
+var fileStatPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "ROOT" }
+	],
+
+	"objects": [
+	{
+		"object": "shadow-mode",
+		"filestat": {
+			"path": "${root}",
+			"file": "^shadow$"
+		}
+	},
+
+	{
+		"object": "shadow-setuid",
+		"filestat": {
+			"path": "${root}",
+			"file": "^shadow$",
+			"attribute": "setuid"
+		}
+	},
+
+	{
+		"object": "shadow-uid",
+		"filestat": {
+			"path": "${root}",
+			"file": "^shadow$",
+			"attribute": "uid"
+		}
+	},
+
+	{
+		"object": "shadow-size",
+		"filestat": {
+			"path": "${root}",
+			"file": "^shadow$",
+			"attribute": "size"
+		}
+	},
+
+	{
+		"object": "all-setuid",
+		"filestat": {
+			"path": "${root}",
+			"file": ".*",
+			"attribute": "setuid"
+		}
+	},
+
+	{
+		"object": "all-mode",
+		"filestat": {
+			"path": "${root}",
+			"file": ".*",
+			"attribute": "mode"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "filestat0",
+		"expectedresult": true,
+		"object": "shadow-mode",
+		"exactmatch": { "value": "0640" }
+	},
+
+	{
+		"test": "filestat1",
+		"expectedresult": true,
+		"object": "shadow-mode",
+		"numeric": { "operation": "<=", "value": "0644" }
+	},
+
+	{
+		"test": "filestat2",
+		"expectedresult": false,
+		"object": "shadow-setuid",
+		"exactmatch": { "value": "true" }
+	},
+
+	{
+		"test": "filestat3",
+		"expectedresult": true,
+		"object": "shadow-uid",
+		"exactmatch": { "value": "UID" }
+	},
+
+	{
+		"test": "filestat4",
+		"expectedresult": true,
+		"object": "shadow-size",
+		"numeric": { "operation": "=", "value": "8" }
+	},
+
+	{
+		"test": "filestat5",
+		"expectedresult": true,
+		"object": "all-setuid",
+		"exactmatch": { "value": "true" }
+	},
+
+	{
+		"test": "filestat6",
+		"expectedresult": false,
+		"object": "all-mode",
+		"match": "all",
+		"numeric": { "operation": "<=", "value": "0755" }
+	}
+	]
+}
+`
+
+func TestFileStatPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scribe")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]os.FileMode{
+		"shadow": 0640,
+		"passwd": 0644,
+		"su":     0755 | os.ModeSetuid,
+	}
+	for k, v := range files {
+		p := filepath.Join(dir, k)
+		err = ioutil.WriteFile(p, []byte("content\n"), 0600)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+		// Set the mode explicitly, so the umask does not apply.
+		err = os.Chmod(p, v)
+		if err != nil {
+			t.Fatalf("os.Chmod: %v", err)
+		}
+	}
+	docstr := strings.Replace(fileStatPolicyDoc, "ROOT", dir, 1)
+	docstr = strings.Replace(docstr, "UID", strconv.Itoa(os.Getuid()), 1)
+	a := genericTestExec(t, docstr)
+
+	res, err := a.GetResults("filestat5")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	for _, x := range res.Results {
+		expect := filepath.Base(x.Identifier) == "su"
+		if x.Result != expect {
+			t.Fatalf("filestat5: unexpected result for %v", x.Identifier)
+		}
+	}
+}
+
+func TestFileStatValidation(t *testing.T) {
+	docs := []string{
+		"objects:\n  - object: obj\n    filestat:\n      path: /\n      file: x\n      attribute: owner\n",
+		"objects:\n  - object: obj\n    filestat:\n      path: /\n      file: \"(\"\n",
+		"objects:\n  - object: obj\n    filestat:\n      path: /\n",
+	}
+	for _, x := range docs {
+		_, err := scribe.LoadDocument(strings.NewReader(x))
+		if err == nil {
+			t.Fatalf("document %q should not validate", x)
+		}
+	}
+}
+
+// Used in TestFileHashPolicy
+var fileHashPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/filecontent" }
+	],
+
+	"objects": [
+	{
+		"object": "testfile1-sha256",
+		"filehash": {
+			"path": "${root}",
+			"file": "^testfile1$"
+		}
+	},
+
+	{
+		"object": "testfile1-sha512",
+		"filehash": {
+			"path": "${root}",
+			"file": "^testfile1$",
+			"algorithm": "sha512"
+		}
+	},
+
+	{
+		"object": "testfile1-sha1",
+		"filehash": {
+			"path": "${root}",
+			"file": "^testfile1$",
+			"algorithm": "sha1"
+		}
+	},
+
+	{
+		"object": "testfiles-sha256",
+		"filehash": {
+			"path": "${root}",
+			"file": "^testfile[0-9]$"
+		}
+	},
+
+	{
+		"object": "testfiles-limited",
+		"filehash": {
+			"path": "${root}",
+			"file": "^testfile[01]$",
+			"maxsize": 25
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "filehash0",
+		"expectedresult": true,
+		"object": "testfile1-sha256",
+		"exactmatch": { "value": "029d7de91ab0fefc19b89404df4f6ebc09629f56cbbb328537b49f518eddfcef" }
+	},
+
+	{
+		"test": "filehash1",
+		"expectedresult": true,
+		"object": "testfile1-sha512",
+		"exactmatch": { "value": "d7e47fd905e632588478cd678aeab57d0c1632a522cfc07f3985292bd815d080b218006b93ba004093a54aa741ea7d0c418d8c4b38c89da74963888d7a8a6555" }
+	},
+
+	{
+		"test": "filehash2",
+		"expectedresult": true,
+		"object": "testfile1-sha1",
+		"exactmatch": { "value": "65461b4b9a6adb47bf871a49e632c5b5b2361b62" }
+	},
+
+	{
+		"test": "filehash3",
+		"expectedresult": false,
+		"object": "testfiles-sha256",
+		"match": "all",
+		"exactmatch": { "value": "029d7de91ab0fefc19b89404df4f6ebc09629f56cbbb328537b49f518eddfcef" }
+	},
+
+	{
+		"test": "filehash4",
+		"expectedresult": true,
+		"object": "testfiles-limited",
+		"match": "all",
+		"exactmatch": { "value": "029d7de91ab0fefc19b89404df4f6ebc09629f56cbbb328537b49f518eddfcef" }
+	}
+	]
+}
+`
+
+func TestFileHashPolicy(t *testing.T) {
+	a := genericTestExec(t, fileHashPolicyDoc)
+
+	// The file exceeding the maximum size should be reported as a warning
+	// rather than hashed.
+	res, err := a.GetResults("filehash4")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(res.Results) != 1 || res.Results[0].Identifier != "test/filecontent/testfile1" {
+		t.Fatalf("unexpected results %+v", res.Results)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0].Path != "test/filecontent/testfile0" {
+		t.Fatalf("unexpected warnings %+v", res.Warnings)
+	}
+}
+
+func TestFileHashValidation(t *testing.T) {
+	docs := []string{
+		"objects:\n  - object: obj\n    filehash:\n      path: /\n      file: x\n      algorithm: md5\n",
+		"objects:\n  - object: obj\n    filehash:\n      path: /\n      file: x\n      maxsize: -1\n",
+		"objects:\n  - object: obj\n    filehash:\n      path: /\n",
+	}
+	for _, x := range docs {
+		_, err := scribe.LoadDocument(strings.NewReader(x))
+		if err == nil {
+			t.Fatalf("document %q should not validate", x)
+		}
+	}
+}
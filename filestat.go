@@ -0,0 +1,213 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+)
+
+// FileStat is used to perform tests against the attributes of files on the
+// file system, such as the permissions or ownership of a file. Files are
+// located in the same way as for FileName, and locator options can be included
+// to control how the file system is searched.
+//
+// Attribute selects the attribute that is returned for each file, and can be
+// one of the following; if unset, mode is used.
+//
+//	mode    the permission and special bits in octal, for example 0640
+//	uid     the numeric user ID of the owner
+//	gid     the numeric group ID of the group
+//	user    the user name of the owner, or the uid if it cannot be resolved
+//	group   the group name of the group, or the gid if it cannot be resolved
+//	size    the size of the file in bytes
+//	mtime   the modification time of the file in seconds since the epoch
+//	nlink   the number of hard links to the file
+//	setuid  true if the setuid bit is set, false otherwise
+//	setgid  true if the setgid bit is set, false otherwise
+//	sticky  true if the sticky bit is set, false otherwise
+//
+// Since the mode is returned with a leading zero, it can be compared with the
+// numeric evaluator using an octal value. Symbolic links are followed, so the
+// attributes are those of the file the link refers to.
+type FileStat struct {
+	Path      string `json:"path,omitempty" yaml:"path,omitempty"`
+	File      string `json:"file,omitempty" yaml:"file,omitempty"`
+	Attribute string `json:"attribute,omitempty" yaml:"attribute,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	matches []statMatch
+}
+
+type statMatch struct {
+	path  string
+	value string
+}
+
+// fileStatAttributes is the set of attributes a FileStat object can return.
+var fileStatAttributes = []string{"mode", "uid", "gid", "user", "group", "size",
+	"mtime", "nlink", "setuid", "setgid", "sticky"}
+
+func (f *FileStat) isChain() bool {
+	return false
+}
+
+func (f *FileStat) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (f *FileStat) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (f *FileStat) validate(d *Document) error {
+	if len(f.Path) == 0 {
+		return fmt.Errorf("filestat path must be set")
+	}
+	if len(f.File) == 0 {
+		return fmt.Errorf("filestat file must be set")
+	}
+	_, err := regexp.Compile(f.File)
+	if err != nil {
+		return err
+	}
+	if f.Attribute != "" {
+		found := false
+		for _, x := range fileStatAttributes {
+			if f.Attribute == x {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("filestat attribute %v is not valid", f.Attribute)
+		}
+	}
+	return f.LocatorOptions.validate()
+}
+
+func (f *FileStat) expandVariables(d *Document, v []Variable) {
+	f.Path = variableExpansion(d, v, f.Path)
+	f.File = variableExpansion(d, v, f.File)
+}
+
+func (f *FileStat) getCriteria(d *Document) (ret []evaluationCriteria) {
+	for _, x := range f.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (f *FileStat) attribute() string {
+	if f.Attribute == "" {
+		return "mode"
+	}
+	return f.Attribute
+}
+
+func (f *FileStat) prepare(ctx context.Context, d *Document) error {
+	d.debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
+
+	sfl := newSimpleFileLocator(d)
+	sfl.root = f.Path
+	err := sfl.setOptions(f.LocatorOptions)
+	if err != nil {
+		return err
+	}
+	err = sfl.locate(ctx, f.File, true)
+	if err != nil {
+		return err
+	}
+	d.addWarnings(sfl.warnings)
+
+	for _, x := range sfl.matches {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fi, err := os.Stat(x)
+		if err != nil {
+			d.warn(x, err)
+			continue
+		}
+		v, err := fileStatValue(fi, f.attribute())
+		if err != nil {
+			d.warn(x, err)
+			continue
+		}
+		d.debugPrint("prepare(): %v %v is \"%v\"\n", x, f.attribute(), v)
+		f.matches = append(f.matches, statMatch{path: x, value: v})
+	}
+
+	return nil
+}
+
+// fileStatValue returns attribute attr from fi as a string.
+func fileStatValue(fi os.FileInfo, attr string) (string, error) {
+	mode := fi.Mode()
+	switch attr {
+	case "mode":
+		bits := uint32(mode.Perm())
+		if mode&os.ModeSetuid != 0 {
+			bits |= 04000
+		}
+		if mode&os.ModeSetgid != 0 {
+			bits |= 02000
+		}
+		if mode&os.ModeSticky != 0 {
+			bits |= 01000
+		}
+		return fmt.Sprintf("%04o", bits), nil
+	case "size":
+		return strconv.FormatInt(fi.Size(), 10), nil
+	case "mtime":
+		return strconv.FormatInt(fi.ModTime().Unix(), 10), nil
+	case "setuid":
+		return strconv.FormatBool(mode&os.ModeSetuid != 0), nil
+	case "setgid":
+		return strconv.FormatBool(mode&os.ModeSetgid != 0), nil
+	case "sticky":
+		return strconv.FormatBool(mode&os.ModeSticky != 0), nil
+	}
+
+	// The remaining attributes come from the underlying system specific
+	// file information.
+	owner, ok := fileOwner(fi)
+	if !ok {
+		return "", fmt.Errorf("filestat attribute %v is not supported on this platform", attr)
+	}
+	uid := strconv.FormatUint(uint64(owner.uid), 10)
+	gid := strconv.FormatUint(uint64(owner.gid), 10)
+	switch attr {
+	case "uid":
+		return uid, nil
+	case "gid":
+		return gid, nil
+	case "nlink":
+		return strconv.FormatUint(owner.nlink, 10), nil
+	case "user":
+		u, err := user.LookupId(uid)
+		if err != nil {
+			return uid, nil
+		}
+		return u.Username, nil
+	case "group":
+		g, err := user.LookupGroupId(gid)
+		if err != nil {
+			return gid, nil
+		}
+		return g.Name, nil
+	}
+	return "", fmt.Errorf("filestat attribute %v is not valid", attr)
+}
@@ -0,0 +1,110 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// topoSort performs a depth first search of the graph where edges returns the
+// nodes a given node depends on, visiting the nodes in the order supplied. It
+// returns the nodes in topological order, with each node following the nodes
+// it depends on. If the graph contains a cycle, the path of the first cycle
+// found is returned instead, starting and ending with the same node.
+func topoSort(nodes []string, edges func(string) []string) (order []string, cycle []string) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	path := make([]string, 0)
+
+	var visit func(n string) bool
+	visit = func(n string) bool {
+		switch state[n] {
+		case visited:
+			return true
+		case visiting:
+			for i := range path {
+				if path[i] == n {
+					cycle = append(cycle, path[i:]...)
+					cycle = append(cycle, n)
+					break
+				}
+			}
+			return false
+		}
+		state[n] = visiting
+		path = append(path, n)
+		for _, x := range edges(n) {
+			if !visit(x) {
+				return false
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+		order = append(order, n)
+		return true
+	}
+
+	for _, x := range nodes {
+		if !visit(x) {
+			return nil, cycle
+		}
+	}
+	return order, nil
+}
+
+// testOrder returns the identifiers of the tests in the document in an order
+// where each test follows any tests it depends on, or an error describing a
+// dependency cycle.
+func (d *Document) testOrder() ([]string, error) {
+	edges := func(n string) []string {
+		t, err := d.GetTest(n)
+		if err != nil {
+			return nil
+		}
+		return t.dependencies()
+	}
+	order, cycle := topoSort(d.GetTestIdentifiers(), edges)
+	if cycle != nil {
+		return nil, fmt.Errorf("test dependency cycle: %v", strings.Join(cycle, " -> "))
+	}
+	return order, nil
+}
+
+// checkChainCycles returns an error if any objects in the document form a
+// cycle through their import-chain entries.
+func (d *Document) checkChainCycles() error {
+	names := make([]string, 0)
+	for _, x := range d.Objects {
+		names = append(names, x.Object)
+	}
+	edges := func(n string) []string {
+		o, err := d.getObject(n)
+		if err != nil {
+			return nil
+		}
+		return o.FileContent.ImportChain
+	}
+	_, cycle := topoSort(names, edges)
+	if cycle != nil {
+		return fmt.Errorf("import-chain cycle: %v", strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// EvaluationOrder returns the identifiers of the tests in the document in the
+// order they will be evaluated, where each test follows any tests it depends
+// on (through If or Depends). Otherwise tests are ordered as they appear in the
+// document. An error is returned if the test dependencies contain a cycle.
+func (d *Document) EvaluationOrder() ([]string, error) {
+	return d.testOrder()
+}
@@ -8,23 +8,28 @@
 package scribe
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 )
 
 // HasLine is used to perform tests against whether or not a file contains a given
-// regular expression
+// regular expression. Locator options can be included to control how the file
+// system is searched.
 type HasLine struct {
 	Path       string `json:"path,omitempty" yaml:"path,omitempty"`
 	File       string `json:"file,omitempty" yaml:"file,omitempty"`
 	Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
 
+	LocatorOptions `yaml:",inline"`
+
 	matches []haslineStatus
 }
 
 type haslineStatus struct {
 	path  string
 	found bool
+	line  int // The line number of the first matching line, if found.
 }
 
 func (h *HasLine) validate(d *Document) error {
@@ -45,13 +50,13 @@ func (h *HasLine) validate(d *Document) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return h.LocatorOptions.validate()
 }
 
 func (h *HasLine) mergeCriteria(c []evaluationCriteria) {
 }
 
-func (h *HasLine) fireChains(d *Document) ([]evaluationCriteria, error) {
+func (h *HasLine) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
 	return nil, nil
 }
 
@@ -59,46 +64,55 @@ func (h *HasLine) isChain() bool {
 	return false
 }
 
-func (h *HasLine) expandVariables(v []Variable) {
-	h.Path = variableExpansion(v, h.Path)
-	h.File = variableExpansion(v, h.File)
+func (h *HasLine) expandVariables(d *Document, v []Variable) {
+	h.Path = variableExpansion(d, v, h.Path)
+	h.File = variableExpansion(d, v, h.File)
 }
 
-func (h *HasLine) getCriteria() (ret []evaluationCriteria) {
+func (h *HasLine) getCriteria(d *Document) (ret []evaluationCriteria) {
 	for _, x := range h.matches {
 		n := evaluationCriteria{}
 		n.identifier = x.path
 		n.testValue = fmt.Sprintf("%v", x.found)
+		n.line = x.line
 		ret = append(ret, n)
 	}
 	return ret
 }
 
-func (h *HasLine) prepare() error {
-	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", h.Path, h.File)
+func (h *HasLine) prepare(ctx context.Context, d *Document) error {
+	d.debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", h.Path, h.File)
 
-	sfl := newSimpleFileLocator()
+	sfl := newSimpleFileLocator(d)
 	sfl.root = h.Path
-	err := sfl.locate(h.File, true)
+	err := sfl.setOptions(h.LocatorOptions)
+	if err != nil {
+		return err
+	}
+	err = sfl.locate(ctx, h.File, true)
 	if err != nil {
 		return err
 	}
+	d.addWarnings(sfl.warnings)
 
 	for _, x := range sfl.matches {
-		m, err := fileContentCheck(x, h.Expression)
-		// XXX These soft errors during preparation are ignored right
-		// now, but they should probably be tracked somewhere.
+		m, err := fileContentCheck(ctx, d, x, h.Expression)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			d.warn(x, err)
 			continue
 		}
 		ncm := haslineStatus{}
 		ncm.path = x
 		if m == nil || len(m) == 0 {
-			debugPrint("prepare(): content not found in \"%v\"\n", x)
+			d.debugPrint("prepare(): content not found in \"%v\"\n", x)
 			ncm.found = false
 		} else {
-			debugPrint("prepare(): content found in \"%v\"\n", x)
+			d.debugPrint("prepare(): content found in \"%v\"\n", x)
 			ncm.found = true
+			ncm.line = m[0].lineno
 		}
 		h.matches = append(h.matches, ncm)
 	}
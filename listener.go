@@ -0,0 +1,362 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The socket states in /proc/net that indicate a listening socket. UDP sockets
+// that are bound but not connected are reported in the close state.
+const (
+	listenerStateTCPListen = "0A"
+	listenerStateUDPClose  = "07"
+)
+
+// Listener is used to perform tests against the sockets listening on the
+// system, as described in /proc/net/tcp, /proc/net/tcp6, /proc/net/udp and
+// /proc/net/udp6. A candidate is returned for each listening socket, with an
+// identifier made up of the protocol and the local endpoint, for example
+// "tcp 127.0.0.1:5432".
+//
+// Field selects the value returned for each socket, and must be set to one of
+// the following.
+//
+//	protocol  the protocol, one of tcp, tcp6, udp or udp6
+//	address   the local address the socket is bound to
+//	port      the local port the socket is bound to
+//	endpoint  the local address and port, for example [::1]:5432
+//	process   the name of the process that owns the socket
+//	pid       the process ID of the process that owns the socket
+//
+// The process that owns a socket is found by examining the open files of each
+// process in /proc, which is only done if Field is process or pid, or Process
+// is set. If the process can not be determined, for example because it
+// belongs to another user and scribe is not running as root, process and pid
+// are empty.
+//
+// The sockets that are considered can be limited using Protocols, a list of
+// protocols to include; Port, a port number; and Process, a regular expression
+// matched against the process name.
+//
+// Root can be set to read /proc relative to a directory other than /.
+type Listener struct {
+	Field     string   `json:"field,omitempty" yaml:"field,omitempty"`
+	Protocols []string `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	Port      int      `json:"port,omitempty" yaml:"port,omitempty"`
+	Process   string   `json:"process,omitempty" yaml:"process,omitempty"`
+	Root      string   `json:"root,omitempty" yaml:"root,omitempty"`
+
+	matches []listenerMatch
+}
+
+type listenerMatch struct {
+	identifier string
+	value      string
+}
+
+// listenerSocket describes a listening socket read from /proc/net.
+type listenerSocket struct {
+	protocol string
+	address  net.IP
+	port     int
+	inode    string
+	pid      string
+	process  string
+}
+
+var listenerProtocols = []string{"tcp", "tcp6", "udp", "udp6"}
+
+var listenerFields = []string{"protocol", "address", "port", "endpoint", "process", "pid"}
+
+func (l *Listener) isChain() bool {
+	return false
+}
+
+func (l *Listener) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (l *Listener) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (l *Listener) validate(d *Document) error {
+	if l.Field == "" {
+		return fmt.Errorf("listener field must be set")
+	}
+	if !listenerContains(listenerFields, l.Field) {
+		return fmt.Errorf("listener field %v is not valid", l.Field)
+	}
+	for _, x := range l.Protocols {
+		if !listenerContains(listenerProtocols, x) {
+			return fmt.Errorf("listener protocol %v is not valid", x)
+		}
+	}
+	if l.Port < 0 || l.Port > 65535 {
+		return fmt.Errorf("listener port %v is not valid", l.Port)
+	}
+	if l.Process != "" {
+		_, err := regexp.Compile(l.Process)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listenerContains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Listener) expandVariables(d *Document, v []Variable) {
+	l.Root = variableExpansion(d, v, l.Root)
+}
+
+func (l *Listener) getCriteria(d *Document) (ret []evaluationCriteria) {
+	for _, x := range l.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (l *Listener) root() string {
+	if l.Root == "" {
+		return "/"
+	}
+	return l.Root
+}
+
+func (l *Listener) prepare(ctx context.Context, d *Document) error {
+	var (
+		procre *regexp.Regexp
+		err    error
+	)
+	if l.Process != "" {
+		procre, err = regexp.Compile(l.Process)
+		if err != nil {
+			return err
+		}
+	}
+	proc := filepath.Join(l.root(), "proc")
+	d.debugPrint("prepare(): reading listening sockets from %v\n", proc)
+
+	protocols := l.Protocols
+	if len(protocols) == 0 {
+		protocols = listenerProtocols
+	}
+	sockets := make([]listenerSocket, 0)
+	for _, x := range protocols {
+		path := filepath.Join(proc, "net", x)
+		if d.object != nil {
+			d.object.stats.filesRead++
+		}
+		s, err := listenerReadSockets(ctx, path, x)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// The IPv6 tables do not exist if IPv6 is disabled.
+			if !os.IsNotExist(err) {
+				d.warn(path, err)
+			}
+			continue
+		}
+		sockets = append(sockets, s...)
+	}
+	if len(sockets) == 0 {
+		return nil
+	}
+
+	// Finding the owner of each socket requires examining every process,
+	// so it is only done if the object needs it.
+	var owners map[string]listenerOwner
+	if l.Field == "process" || l.Field == "pid" || procre != nil {
+		d.debugPrint("prepare(): finding socket owners in %v\n", proc)
+		owners, err = listenerSocketOwners(ctx, proc)
+		if err != nil {
+			return err
+		}
+	}
+	for _, x := range sockets {
+		if o, ok := owners[x.inode]; ok {
+			x.pid = o.pid
+			x.process = o.process
+		}
+		if l.Port != 0 && x.port != l.Port {
+			continue
+		}
+		if procre != nil && !procre.MatchString(x.process) {
+			continue
+		}
+		n := listenerMatch{}
+		n.identifier = x.protocol + " " + x.endpoint()
+		n.value = x.field(l.Field)
+		d.debugPrint("prepare(): listener %v, process \"%v\" (%v)\n", n.identifier, x.process, x.pid)
+		l.matches = append(l.matches, n)
+	}
+	return nil
+}
+
+func (s *listenerSocket) endpoint() string {
+	return net.JoinHostPort(s.address.String(), strconv.Itoa(s.port))
+}
+
+func (s *listenerSocket) field(f string) string {
+	switch f {
+	case "protocol":
+		return s.protocol
+	case "address":
+		return s.address.String()
+	case "port":
+		return strconv.Itoa(s.port)
+	case "endpoint":
+		return s.endpoint()
+	case "process":
+		return s.process
+	case "pid":
+		return s.pid
+	}
+	return ""
+}
+
+// listenerReadSockets returns the listening sockets described in the
+// /proc/net table at path for protocol.
+func listenerReadSockets(ctx context.Context, path string, protocol string) ([]listenerSocket, error) {
+	ret := make([]listenerSocket, 0)
+	listenState := listenerStateTCPListen
+	if strings.HasPrefix(protocol, "udp") {
+		listenState = listenerStateUDPClose
+	}
+	var perr error
+	lineno := 0
+	err := scanFileLines(ctx, path, func(ln string) {
+		lineno++
+		fields := strings.Fields(ln)
+		// Skip the header, and anything we do not recognize.
+		if lineno == 1 || len(fields) < 10 || perr != nil {
+			return
+		}
+		if fields[3] != listenState {
+			return
+		}
+		addr, port, err := listenerParseAddress(fields[1])
+		if err != nil {
+			perr = fmt.Errorf("line %v: %v", lineno, err)
+			return
+		}
+		ret = append(ret, listenerSocket{protocol: protocol, address: addr,
+			port: port, inode: fields[9]})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if perr != nil {
+		return nil, perr
+	}
+	return ret, nil
+}
+
+// listenerParseAddress parses an address and port from /proc/net, such as
+// 0100007F:0CEA. The address is made up of 32 bit words which the kernel
+// writes in host byte order.
+func listenerParseAddress(s string) (net.IP, int, error) {
+	idx := strings.Index(s, ":")
+	if idx == -1 {
+		return nil, 0, fmt.Errorf("invalid socket address %v", s)
+	}
+	buf, err := hex.DecodeString(s[:idx])
+	if err != nil || (len(buf) != net.IPv4len && len(buf) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid socket address %v", s)
+	}
+	ip := make(net.IP, len(buf))
+	for i := 0; i < len(buf); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.NativeEndian.Uint32(buf[i:]))
+	}
+	port, err := strconv.ParseUint(s[idx+1:], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid socket port %v", s)
+	}
+	return ip, int(port), nil
+}
+
+type listenerOwner struct {
+	pid     string
+	process string
+}
+
+// listenerSocketOwners returns the process that owns each socket inode, by
+// examining the file descriptors of each process in proc. Processes that can
+// not be examined are skipped. If a socket is shared by several processes the
+// one with the lowest process ID is used.
+func listenerSocketOwners(ctx context.Context, proc string) (map[string]listenerOwner, error) {
+	ret := make(map[string]listenerOwner)
+	dirents, err := ioutil.ReadDir(proc)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	pids := make([]int, 0)
+	for _, x := range dirents {
+		pid, err := strconv.Atoi(x.Name())
+		if err != nil || !x.IsDir() {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	for _, pid := range pids {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		pidstr := strconv.Itoa(pid)
+		fds, err := ioutil.ReadDir(filepath.Join(proc, pidstr, "fd"))
+		if err != nil {
+			continue
+		}
+		var process string
+		for _, x := range fds {
+			link, err := os.Readlink(filepath.Join(proc, pidstr, "fd", x.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+				continue
+			}
+			inode := link[len("socket:[") : len(link)-1]
+			if _, ok := ret[inode]; ok {
+				continue
+			}
+			if process == "" {
+				buf, err := ioutil.ReadFile(filepath.Join(proc, pidstr, "comm"))
+				if err == nil {
+					process = strings.TrimSpace(string(buf))
+				}
+			}
+			ret[inode] = listenerOwner{pid: pidstr, process: process}
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,191 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestListenerPolicy
+var listenerPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/listener" }
+	],
+
+	"objects": [
+	{
+		"object": "ports",
+		"listener": {
+			"field": "port",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "tcp4-ports",
+		"listener": {
+			"field": "port",
+			"protocols": [ "tcp" ],
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "postgres-addresses",
+		"listener": {
+			"field": "address",
+			"port": 5432,
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "processes",
+		"listener": {
+			"field": "process",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "postgres-endpoints",
+		"listener": {
+			"field": "endpoint",
+			"process": "^postgres$",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "protocols",
+		"listener": {
+			"field": "protocol",
+			"root": "${root}"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "listener0",
+		"expectedresult": true,
+		"object": "ports",
+		"exactmatch": { "value": "23" }
+	},
+
+	{
+		"test": "listener1",
+		"expectedresult": false,
+		"object": "tcp4-ports",
+		"exactmatch": { "value": "23" }
+	},
+
+	{
+		"test": "listener2",
+		"expectedresult": true,
+		"object": "postgres-addresses",
+		"match": "all",
+		"regexp": { "value": "^(127\\.0\\.0\\.1|::1)$" }
+	},
+
+	{
+		"test": "listener3",
+		"expectedresult": true,
+		"object": "processes",
+		"exactmatch": { "value": "sshd" }
+	},
+
+	{
+		"test": "listener4",
+		"expectedresult": true,
+		"object": "postgres-endpoints",
+		"match": "count",
+		"mincount": 2,
+		"maxcount": 2
+	},
+
+	{
+		"test": "listener5",
+		"expectedresult": true,
+		"object": "protocols",
+		"exactmatch": { "value": "udp" }
+	}
+	]
+}
+`
+
+func TestListenerPolicy(t *testing.T) {
+	a := genericTestExec(t, listenerPolicyDoc)
+
+	res, err := a.GetResults("listener4")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	expect := []string{"tcp 127.0.0.1:5432", "tcp6 [::1]:5432"}
+	if len(res.Results) != len(expect) {
+		t.Fatalf("unexpected results %+v", res.Results)
+	}
+	for i := range expect {
+		if res.Results[i].Identifier != expect[i] {
+			t.Fatalf("expected identifier %v, got %v", expect[i], res.Results[i].Identifier)
+		}
+	}
+
+	// Sockets without a known owner should have an empty process name.
+	res, err = a.GetResults("listener3")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	procs := make(map[string]string)
+	for _, x := range res.Results {
+		procs[x.Identifier] = x.Value
+	}
+	if procs["tcp 0.0.0.0:22"] != "sshd" || procs["udp 0.0.0.0:68"] != "" || len(procs) != 5 {
+		t.Fatalf("unexpected processes %v", procs)
+	}
+}
+
+func TestListenerSocketOwners(t *testing.T) {
+	var buf bytes.Buffer
+	e := scribe.NewEngine(scribe.WithTestHooks(true), scribe.WithDebug(&buf))
+	doc, err := e.LoadDocument(strings.NewReader(listenerPolicyDoc))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	err = e.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("Engine.AnalyzeDocument: %v", err)
+	}
+	// Only the processes and postgres-endpoints objects need the owner
+	// of each socket.
+	lookups := strings.Count(buf.String(), "prepare(): finding socket owners")
+	if lookups != 2 {
+		t.Fatalf("socket owners found %v times", lookups)
+	}
+}
+
+func TestListenerValidation(t *testing.T) {
+	for _, x := range []string{
+		"field: name",
+		"field: port\n      protocols: [ sctp ]",
+		"field: port\n      port: 70000",
+		"field: port\n      process: \"(\"",
+		"port: 22",
+	} {
+		docstr := "objects:\n  - object: obj\n    listener:\n      " + x + "\n"
+		_, err := scribe.LoadDocument(strings.NewReader(docstr))
+		if err == nil {
+			t.Fatalf("document with %q should not validate", x)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The default maximum directory depth that will be searched when locating
+// files.
+const defaultLocatorMaxDepth = 10
+
+// LocatorOptions controls how files are located on the file system for
+// objects that search for files, such as FileContent, FileName, FileStat,
+// FileHash, ConfigKey and HasLine. All options are optional.
+//
+// MaxDepth is the maximum directory depth that will be searched, relative to
+// the path specified in the object. If unset a depth of 10 is used.
+//
+// Exclude is a list of regular expressions that are matched against the full
+// path of each file and directory encountered. Matching files are ignored, and
+// matching directories are not descended into.
+//
+// If XDev is true, directories on a different file system than the path
+// specified in the object are not descended into.
+//
+// If FollowSymlinks is true, symbolic links to directories will be followed.
+// Symbolic links to regular files are always considered. Each directory is
+// only searched once, so a link to a directory that has already been searched
+// (such as a link to a parent directory) is ignored.
+//
+// If MaxFileSize is non-zero, files larger than MaxFileSize bytes are ignored.
+type LocatorOptions struct {
+	MaxDepth       int      `json:"maxdepth,omitempty" yaml:"maxdepth,omitempty"`
+	Exclude        []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	XDev           bool     `json:"xdev,omitempty" yaml:"xdev,omitempty"`
+	FollowSymlinks bool     `json:"followsymlinks,omitempty" yaml:"followsymlinks,omitempty"`
+	MaxFileSize    int64    `json:"maxfilesize,omitempty" yaml:"maxfilesize,omitempty"`
+}
+
+// FileLocator is a function that can be installed to locate candidate files on
+// the file system in place of the built-in locator. target is the file name
+// to search for (a regular expression if useRegexp is true), and root is the
+// directory the search starts from. opts contains the locator options from the
+// object, with MaxDepth always set to the effective search depth. The function
+// returns the paths of all matching files.
+type FileLocator func(target string, useRegexp bool, root string, opts LocatorOptions) ([]string, error)
+
+func (l *LocatorOptions) validate() error {
+	if l.MaxDepth < 0 {
+		return fmt.Errorf("maxdepth cannot be negative")
+	}
+	if l.MaxFileSize < 0 {
+		return fmt.Errorf("maxfilesize cannot be negative")
+	}
+	for _, x := range l.Exclude {
+		if len(x) == 0 {
+			return fmt.Errorf("exclude expression cannot be empty")
+		}
+		_, err := regexp.Compile(x)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// effective returns a copy of the options with any defaults applied.
+func (l LocatorOptions) effective() LocatorOptions {
+	if l.MaxDepth == 0 {
+		l.MaxDepth = defaultLocatorMaxDepth
+	}
+	return l
+}
+
+// key returns a string that uniquely identifies the options, for use in
+// caching file system walks.
+func (l LocatorOptions) key() string {
+	l = l.effective()
+	return fmt.Sprintf("%v:%v:%v:%v:%v", l.MaxDepth, l.XDev, l.FollowSymlinks,
+		l.MaxFileSize, strings.Join(l.Exclude, "\x00"))
+}
+
+// fileID uniquely identifies a file on the system.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileOwnerInfo contains the system specific file information used by FileStat.
+type fileOwnerInfo struct {
+	uid   uint32
+	gid   uint32
+	nlink uint64
+}
+
+type simpleFileLocator struct {
+	executed bool
+	root     string
+	curDepth int
+	matches  []string
+	warnings []objectWarning
+	locator  FileLocator
+	index    *fileIndex
+	stats    *objectStats // Stats for the object the locator is used by, if any.
+
+	opts    LocatorOptions
+	exclude []*regexp.Regexp
+	rootDev uint64          // Device of root, used if opts.XDev is set.
+	visited map[fileID]bool // Directories that have been walked.
+}
+
+func newSimpleFileLocator(d *Document) (ret simpleFileLocator) {
+	// XXX This needs to be fixed to work with Windows.
+	ret.root = "/"
+	ret.opts = ret.opts.effective()
+	ret.matches = make([]string, 0)
+	e := d.getEngine()
+	if e.fileLocator != nil {
+		ret.locator = e.fileLocator
+	}
+	ret.index = d.fsIndex
+	if d != nil && d.object != nil {
+		ret.stats = &d.object.stats
+	}
+	return ret
+}
+
+// setOptions configures the locator using options opts.
+func (s *simpleFileLocator) setOptions(opts LocatorOptions) error {
+	s.opts = opts.effective()
+	s.exclude = nil
+	for _, x := range s.opts.Exclude {
+		re, err := regexp.Compile(x)
+		if err != nil {
+			return err
+		}
+		s.exclude = append(s.exclude, re)
+	}
+	return nil
+}
+
+func (s *simpleFileLocator) locate(ctx context.Context, target string, useRegexp bool) error {
+	if s.executed {
+		return fmt.Errorf("locator has already been executed")
+	}
+	s.executed = true
+	if s.locator != nil {
+		// Installed locator functions do not accept a context, so the
+		// best we can do is discard the results if the context was
+		// cancelled while the locator was running.
+		buf, err := s.locator(target, useRegexp, s.root, s.opts)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		s.matches = buf
+		return nil
+	}
+	var err error
+	if s.index != nil {
+		err = s.locateIndexed(ctx, target, useRegexp)
+	} else {
+		err = s.locateRoot(ctx, target, useRegexp)
+	}
+	if err != nil {
+		return err
+	}
+	return s.filterWarnings(target, useRegexp)
+}
+
+// filterWarnings removes any warnings that could not have affected the result
+// of a search for target. Walks of a root are shared between objects, so the
+// warnings from a walk can relate to files the object was never looking for.
+// A warning for a directory is always kept, since files under the directory
+// could have matched; a warning for any other path is only kept if the base
+// name of the path matches target in the same way as a candidate file would.
+func (s *simpleFileLocator) filterWarnings(target string, useRegexp bool) error {
+	var re *regexp.Regexp
+	if useRegexp {
+		var err error
+		re, err = regexp.Compile(target)
+		if err != nil {
+			return err
+		}
+	}
+	ret := make([]objectWarning, 0, len(s.warnings))
+	for _, x := range s.warnings {
+		name := filepath.Base(x.path)
+		if x.dir || (useRegexp && re.MatchString(name)) || (!useRegexp && name == target) {
+			ret = append(ret, x)
+		}
+	}
+	s.warnings = ret
+	return nil
+}
+
+// locateIndexed locates files using the file index for the analysis, rather
+// than walking the file system directly. The index returns every file found
+// under the root, and we filter the results here.
+func (s *simpleFileLocator) locateIndexed(ctx context.Context, target string, useRegexp bool) error {
+	var (
+		re  *regexp.Regexp
+		err error
+	)
+	if useRegexp {
+		re, err = regexp.Compile(target)
+		if err != nil {
+			return err
+		}
+	}
+	files, warnings, err := s.index.walk(ctx, s.root, s.opts)
+	if err != nil {
+		return err
+	}
+	s.warnings = append(s.warnings, warnings...)
+	if s.stats != nil {
+		s.stats.filesWalked += len(files)
+	}
+	for _, x := range files {
+		name := filepath.Base(x)
+		if !useRegexp {
+			if name == target {
+				s.matches = append(s.matches, x)
+			}
+		} else {
+			if re.MatchString(name) {
+				s.matches = append(s.matches, x)
+			}
+		}
+	}
+	return nil
+}
+
+// locateRoot walks the file system from the root of the locator.
+func (s *simpleFileLocator) locateRoot(ctx context.Context, target string, useRegexp bool) error {
+	s.visited = make(map[fileID]bool)
+	fi, err := os.Stat(s.root)
+	if err != nil {
+		// There is nothing to walk if the root does not exist.
+		if !os.IsNotExist(err) {
+			s.warnings = append(s.warnings, objectWarning{path: s.root, err: err, dir: true})
+		}
+		return nil
+	}
+	s.rootDev, _ = fileDevice(fi)
+	s.markVisited(fi)
+	return s.locateInner(ctx, target, useRegexp, "")
+}
+
+// markVisited records that the directory described by fi has been walked,
+// returning false if it had already been visited. A directory can be reached
+// more than once through symbolic links or bind mounts, and doing so could
+// otherwise loop until the maximum depth is reached.
+func (s *simpleFileLocator) markVisited(fi os.FileInfo) bool {
+	id, ok := fileIdentity(fi)
+	if !ok {
+		return true
+	}
+	if s.visited[id] {
+		return false
+	}
+	s.visited[id] = true
+	return true
+}
+
+// isExcluded returns true if path matches one of the exclusion expressions.
+func (s *simpleFileLocator) isExcluded(path string) bool {
+	for _, x := range s.exclude {
+		if x.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// crossesDevice returns true if fi describes a directory on a different file
+// system than the root, and the locator has been configured not to cross file
+// system boundaries.
+func (s *simpleFileLocator) crossesDevice(fi os.FileInfo) bool {
+	if !s.opts.XDev {
+		return false
+	}
+	dev, ok := fileDevice(fi)
+	if !ok {
+		return false
+	}
+	return dev != s.rootDev
+}
+
+// tooLarge returns true if fi describes a file that exceeds the maximum file
+// size for the locator.
+func (s *simpleFileLocator) tooLarge(fi os.FileInfo) bool {
+	return s.opts.MaxFileSize > 0 && fi.Size() > s.opts.MaxFileSize
+}
+
+func (s *simpleFileLocator) locateInner(ctx context.Context, target string, useRegexp bool, path string) error {
+	var (
+		spath string
+		re    *regexp.Regexp
+		err   error
+	)
+
+	// Stop walking the file system if the context has been cancelled.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// If processing this directory would result in us exceeding the
+	// specified search depth, just ignore it.
+	if (s.curDepth + 1) > s.opts.MaxDepth {
+		return nil
+	}
+
+	if useRegexp {
+		re, err = regexp.Compile(target)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.curDepth++
+	defer func() {
+		s.curDepth--
+	}()
+
+	if path == "" {
+		spath = s.root
+	} else {
+		spath = path
+	}
+	dirents, err := ioutil.ReadDir(spath)
+	if err != nil {
+		// If we encounter an error while reading a directory, record
+		// it and keep going until we are finished. A directory that
+		// does not exist is not considered a warning, it simply has
+		// no matches.
+		if !os.IsNotExist(err) {
+			s.warnings = append(s.warnings, objectWarning{path: spath, err: err, dir: true})
+		}
+		return nil
+	}
+	for _, x := range dirents {
+		fname := filepath.Join(spath, x.Name())
+		if s.isExcluded(fname) {
+			continue
+		}
+		fi := x
+		if (x.Mode() & os.ModeSymlink) > 0 {
+			fi, err = os.Stat(fname)
+			if err != nil {
+				// Record the error and continue searching, unless
+				// this is just a dangling link. If links to
+				// directories are followed, the link may have
+				// referred to a directory.
+				if !os.IsNotExist(err) {
+					s.warnings = append(s.warnings, objectWarning{path: fname, err: err,
+						dir: s.opts.FollowSymlinks})
+				}
+				continue
+			}
+			if fi.IsDir() && !s.opts.FollowSymlinks {
+				continue
+			}
+		}
+		if fi.IsDir() {
+			if s.crossesDevice(fi) || !s.markVisited(fi) {
+				continue
+			}
+			err = s.locateInner(ctx, target, useRegexp, fname)
+			if err != nil {
+				return err
+			}
+		} else if fi.Mode().IsRegular() {
+			if s.tooLarge(fi) {
+				continue
+			}
+			if !useRegexp {
+				if x.Name() == target {
+					s.matches = append(s.matches, fname)
+				}
+			} else {
+				if re.MatchString(x.Name()) {
+					s.matches = append(s.matches, fname)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build !windows
+// +build !windows
+
+package scribe
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileDevice returns the device number of the file system fi resides on. The
+// second return value is false if the device could not be determined.
+func fileDevice(fi os.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// fileIdentity returns the device and inode of the file described by fi. The
+// second return value is false if they could not be determined.
+func fileIdentity(fi os.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// fileOwner returns the ownership and link count of the file described by fi.
+// The second return value is false if the information is not available.
+func fileOwner(fi os.FileInfo) (fileOwnerInfo, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileOwnerInfo{}, false
+	}
+	return fileOwnerInfo{uid: st.Uid, gid: st.Gid, nlink: uint64(st.Nlink)}, true
+}
@@ -0,0 +1,33 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build windows
+// +build windows
+
+package scribe
+
+import (
+	"os"
+)
+
+// fileDevice is not supported on Windows, so file system boundaries are not
+// detected.
+func fileDevice(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// fileIdentity is not supported on Windows, so directories that are reachable
+// more than once are walked each time; the maximum depth still applies.
+func fileIdentity(fi os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// fileOwner is not supported on Windows, since files do not have a Unix style
+// owner and group.
+func fileOwner(fi os.FileInfo) (fileOwnerInfo, bool) {
+	return fileOwnerInfo{}, false
+}
@@ -8,7 +8,10 @@
 package scribe_test
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/mozilla/scribe"
 )
 
 // Used in testConcatPolicy
@@ -183,3 +186,284 @@ var rawPolicyDoc = `
 func TestRawPolicy(t *testing.T) {
 	genericTestExec(t, rawPolicyDoc)
 }
+
+// Used in TestMatchPolicy
+var matchPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "values",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "a", "value": "1" },
+			{ "identifier": "b", "value": "5" },
+			{ "identifier": "c", "value": "10" }
+			]
+		}
+	},
+
+	{
+		"object": "nofiles",
+		"filename": {
+			"path": "./test/filename",
+			"file": "nonexistent-(\\S+)"
+		}
+	}
+	],
+
+	"tests": [
+	{ "test": "match0", "object": "values", "expectedresult": true,
+	  "numeric": { "operation": ">", "value": "5" } },
+	{ "test": "match1", "object": "values", "expectedresult": false, "match": "all",
+	  "numeric": { "operation": ">", "value": "5" } },
+	{ "test": "match2", "object": "values", "expectedresult": true, "match": "all",
+	  "numeric": { "operation": ">", "value": "0" } },
+	{ "test": "match3", "object": "values", "expectedresult": false, "match": "none",
+	  "numeric": { "operation": ">", "value": "5" } },
+	{ "test": "match4", "object": "values", "expectedresult": true, "match": "none",
+	  "numeric": { "operation": ">", "value": "10" } },
+	{ "test": "match5", "object": "values", "expectedresult": true, "match": "count",
+	  "mincount": 2, "maxcount": 2, "numeric": { "operation": ">=", "value": "5" } },
+	{ "test": "match6", "object": "values", "expectedresult": false, "match": "count",
+	  "mincount": 3, "numeric": { "operation": ">=", "value": "5" } },
+	{ "test": "match7", "object": "values", "expectedresult": false, "match": "count",
+	  "maxcount": 1, "numeric": { "operation": ">=", "value": "5" } },
+	{ "test": "match8", "object": "nofiles", "expectedresult": false },
+	{ "test": "match9", "object": "nofiles", "expectedresult": false, "match": "all" },
+	{ "test": "match10", "object": "nofiles", "expectedresult": true, "match": "none" },
+	{ "test": "match11", "object": "nofiles", "expectedresult": true, "match": "count",
+	  "maxcount": 1 },
+	{ "test": "match12", "object": "nofiles", "expectedresult": false, "match": "count",
+	  "mincount": 1 }
+	]
+}
+`
+
+func TestMatchPolicy(t *testing.T) {
+	a := genericTestExec(t, matchPolicyDoc)
+	// match1 has true results but fails because of its match mode, rather
+	// than because of a dependency.
+	res, err := a.GetResults("match1")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if !res.HasTrueResults || strings.Contains(res.String(), "dependency") {
+		t.Fatalf("match1: unexpected result %v", res.String())
+	}
+}
+
+func TestMatchValidation(t *testing.T) {
+	invalid := []string{
+		`"match": "some"`,
+		`"mincount": 1`,
+		`"match": "all", "maxcount": 1`,
+		`"match": "count", "mincount": 3, "maxcount": 2`,
+		`"match": "count", "mincount": -1`,
+	}
+	for _, x := range invalid {
+		doc := `{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "1"}]}}],
+		"tests": [{"test": "t", "object": "o", ` + x + `}]}`
+		_, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err == nil {
+			t.Fatalf("LoadDocument: expected error for %v", x)
+		}
+	}
+}
+
+// Used in TestDependsPolicy
+var dependsPolicyDoc = `
+objects:
+  - object: platform
+    raw:
+      identifiers:
+        - identifier: release
+          value: centos7
+tests:
+  - test: centos6
+    object: platform
+    exactmatch:
+      value: centos6
+  - test: centos7
+    expectedresult: true
+    object: platform
+    exactmatch:
+      value: centos7
+  - test: container
+    object: platform
+    exactmatch:
+      value: container
+  - test: depends0
+    expectedresult: true
+    object: platform
+    depends:
+      allof:
+        - anyof: [ centos6, centos7 ]
+        - noneof: [ container ]
+  - test: depends1
+    expectedresult: false
+    object: platform
+    depends:
+      anyof: [ centos6, container ]
+  - test: depends2
+    expectedresult: false
+    object: platform
+    depends:
+      noneof:
+        - test: centos6
+        - allof: [ centos7, depends0 ]
+  - test: depends3
+    expectedresult: false
+    object: platform
+    if: [ centos6 ]
+    depends:
+      anyof: [ centos7 ]
+  - test: depends4
+    expectedresult: true
+    object: platform
+    if: [ centos7 ]
+    depends: depends0
+  - test: broken
+    expecterror: true
+    object: platform
+    numeric:
+      operation: "="
+      value: "7"
+  - test: depends5
+    expectedresult: true
+    object: platform
+    depends:
+      anyof: [ broken, centos7 ]
+  - test: depends6
+    expectedresult: false
+    object: platform
+    depends:
+      allof: [ broken, centos6 ]
+  - test: depends7
+    expectedresult: false
+    object: platform
+    depends:
+      noneof: [ broken, centos7 ]
+  - test: depends8
+    expecterror: true
+    object: platform
+    depends:
+      anyof: [ broken, centos6 ]
+  - test: depends9
+    expecterror: true
+    object: platform
+    depends:
+      allof: [ broken, centos7 ]
+`
+
+func TestDependsPolicy(t *testing.T) {
+	a := genericTestExec(t, dependsPolicyDoc)
+	res, err := a.GetResults("depends1")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if res.Status != scribe.StatusSkipped {
+		t.Fatalf("depends1 should have been skipped, status was %v", res.Status)
+	}
+	if !strings.Contains(res.String(), "master result: false, has true results, failure caused by dependency") {
+		t.Fatalf("depends1: unexpected result %v", res.String())
+	}
+}
+
+func TestDependsValidation(t *testing.T) {
+	invalid := []string{
+		`"depends": "unknown"`,
+		`"depends": {"anyof": ["a", "t"]}`,
+		`"depends": {"allof": []}`,
+		`"depends": {"test": "a", "anyof": ["a"]}`,
+		`"depends": {"noneof": [{"allof": ["a", "missing"]}]}`,
+	}
+	for _, x := range invalid {
+		doc := `{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "1"}]}}],
+		"tests": [{"test": "a", "object": "o"}, {"test": "t", "object": "o", ` + x + `}]}`
+		_, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err == nil {
+			t.Fatalf("LoadDocument: expected error for %v", x)
+		}
+	}
+}
+
+// Used in TestDependencyCycles
+var cycleObjects = `
+objects:
+  - object: o
+    raw:
+      identifiers:
+        - identifier: a
+          value: "1"
+  - object: chain0
+    filecontent:
+      path: ./test/import-chain
+      file: testfile0
+      expression: (.*)
+      import-chain: [ chain1 ]
+  - object: chain1
+    filecontent:
+      path: ${chain_root}
+      file: testfile1
+      expression: (.*)
+      import-chain: [ chain2 ]
+  - object: chain2
+    filecontent:
+      path: ${chain_root}
+      file: testfile1
+      expression: (.*)
+`
+
+func TestDependencyCycles(t *testing.T) {
+	invalid := []struct {
+		tests  string
+		expect string
+	}{
+		{`
+  - { test: a, object: o, if: [ b ] }
+  - { test: b, object: o, if: [ a ] }
+`, "test dependency cycle: a -> b -> a"},
+		{`
+  - { test: a, object: o }
+  - { test: b, object: o, if: [ c ] }
+  - { test: c, object: o, depends: { anyof: [ a, d ] } }
+  - { test: d, object: o, depends: { noneof: [ b ] } }
+`, "test dependency cycle: b -> c -> d -> b"},
+	}
+	for _, x := range invalid {
+		doc := cycleObjects + "tests:" + x.tests
+		_, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err == nil {
+			t.Fatalf("LoadDocument: expected error for %v", x.tests)
+		}
+		if err.Error() != x.expect {
+			t.Fatalf("LoadDocument: unexpected error %q", err)
+		}
+	}
+
+	doc := strings.Replace(cycleObjects, "import-chain: [ chain2 ]", "import-chain: [ chain0 ]", 1)
+	doc += "tests:\n  - { test: a, object: chain0 }\n"
+	_, err := scribe.LoadDocument(strings.NewReader(doc))
+	if err == nil || err.Error() != "import-chain cycle: chain0 -> chain1 -> chain0" {
+		t.Fatalf("LoadDocument: unexpected error for import-chain cycle %v", err)
+	}
+}
+
+func TestEvaluationOrder(t *testing.T) {
+	doc, err := scribe.LoadDocument(strings.NewReader(cycleObjects + `tests:
+  - { test: a, object: o, if: [ c ] }
+  - { test: b, object: o }
+  - { test: c, object: o, depends: { allof: [ d, b ] } }
+  - { test: d, object: o }
+`))
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	order, err := doc.EvaluationOrder()
+	if err != nil {
+		t.Fatalf("Document.EvaluationOrder: %v", err)
+	}
+	if strings.Join(order, " ") != "d b c a" {
+		t.Fatalf("Document.EvaluationOrder: unexpected order %v", order)
+	}
+}
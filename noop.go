@@ -10,8 +10,9 @@ package scribe
 type noop struct {
 }
 
-func (n *noop) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
+func (n *noop) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
 	ret.criteria = c
+	ret.evaluator = "noop"
 	ret.result = true
 	return
 }
@@ -0,0 +1,152 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NumericTest describes a numeric comparison that will be performed as part of
+// a test. Operation can be one of "<", "<=", ">", ">=", "=" or "!=", and the
+// value returned by the object is compared against Value.
+//
+// Both Value and the value returned by the object are parsed using the
+// following rules, after surrounding whitespace is removed. Each may begin with
+// a + or - sign.
+//
+//	0x or 0X followed by hex digits      a hexadecimal integer, such as 0x10
+//	0 followed by the digits 0 to 7      an octal integer, such as a umask of 022
+//	the digits 0 to 9                    a decimal integer, such as 90
+//	digits with a . or exponent          a decimal floating point value, such as 0.75
+//
+// Anything else is not numeric, including an integer with a leading zero that
+// contains an 8 or 9 (such as 08), binary or 0o prefixes, underscores, and
+// infinity or NaN. If the value returned by the object is not numeric the test
+// will result in an error.
+type NumericTest struct {
+	Operation string `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Value     string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// numericValue is a parsed numeric value; if isint is true the value is
+// compared as an integer, otherwise as a float.
+type numericValue struct {
+	isint bool
+	i     int64
+	f     float64
+}
+
+// parseNumeric parses s according to the rules described for NumericTest.
+func parseNumeric(s string) (ret numericValue, err error) {
+	s = strings.TrimSpace(s)
+	invalid := fmt.Errorf("value \"%v\" is not numeric", s)
+	digits := strings.TrimLeft(s, "+-")
+	sign := s[:len(s)-len(digits)]
+	if len(sign) > 1 || digits == "" {
+		return ret, invalid
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X"):
+		base = 16
+		digits = digits[2:]
+		if digits == "" || strings.Trim(digits, "0123456789abcdefABCDEF") != "" {
+			return ret, invalid
+		}
+	case strings.Trim(digits, "0123456789") != "":
+		// Not an integer, so it must be a decimal floating point
+		// value. ParseFloat also accepts hex floats, underscores and
+		// the names of special values, so only digits, the decimal
+		// point and exponent are permitted.
+		if strings.Trim(digits, "0123456789.eE+-") != "" {
+			return ret, invalid
+		}
+		ret.f, err = strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(ret.f, 0) {
+			return ret, invalid
+		}
+		return ret, nil
+	case len(digits) > 1 && digits[0] == '0':
+		base = 8
+		if strings.Trim(digits, "01234567") != "" {
+			return ret, invalid
+		}
+	}
+	ret.i, err = strconv.ParseInt(sign+digits, base, 64)
+	if err != nil {
+		return ret, invalid
+	}
+	ret.isint = true
+	ret.f = float64(ret.i)
+	return ret, nil
+}
+
+// compare returns -1 if n is less than o, 1 if it is greater, and 0 if they
+// are equal.
+func (n numericValue) compare(o numericValue) int {
+	if n.isint && o.isint {
+		if n.i < o.i {
+			return -1
+		} else if n.i > o.i {
+			return 1
+		}
+		return 0
+	}
+	if n.f < o.f {
+		return -1
+	} else if n.f > o.f {
+		return 1
+	}
+	return 0
+}
+
+func (n *NumericTest) validate() error {
+	if evrLookupOperation(n.Operation) == EvropUnknown {
+		return fmt.Errorf("invalid numeric operation %v", n.Operation)
+	}
+	_, err := parseNumeric(n.Value)
+	return err
+}
+
+func (n *NumericTest) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
+	d.debugPrint("evaluate(): numeric %v \"%v\", %v \"%v\"\n", c.identifier, c.testValue, n.Operation, n.Value)
+	ret.criteria = c
+	ret.evaluator = "numeric"
+	ret.expression = fmt.Sprintf("%v %v %v", c.testValue, n.Operation, n.Value)
+	op := evrLookupOperation(n.Operation)
+	if op == EvropUnknown {
+		return ret, fmt.Errorf("invalid numeric operation %v", n.Operation)
+	}
+	actual, err := parseNumeric(c.testValue)
+	if err != nil {
+		return ret, err
+	}
+	check, err := parseNumeric(n.Value)
+	if err != nil {
+		return ret, err
+	}
+	r := actual.compare(check)
+	switch op {
+	case EvropLessThan:
+		ret.result = r < 0
+	case EvropLessThanOrEqual:
+		ret.result = r <= 0
+	case EvropGreaterThan:
+		ret.result = r > 0
+	case EvropGreaterThanOrEqual:
+		ret.result = r >= 0
+	case EvropEquals:
+		ret.result = r == 0
+	case EvropNotEquals:
+		ret.result = r != 0
+	}
+	return ret, nil
+}
@@ -8,7 +8,10 @@
 package scribe
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
 // Object describes data that will be sourced from the system and used in a
@@ -22,20 +25,41 @@ type Object struct {
 	Package     Pkg         `json:"package" yaml:"package"`
 	Raw         Raw         `json:"raw" yaml:"raw"`
 	HasLine     HasLine     `json:"hasline" yaml:"hasline"`
+	FileStat    FileStat    `json:"filestat" yaml:"filestat"`
+	FileHash    FileHash    `json:"filehash" yaml:"filehash"`
+	ConfigKey   ConfigKey   `json:"configkey" yaml:"configkey"`
+	Sysctl      Sysctl      `json:"sysctl" yaml:"sysctl"`
+	Listener    Listener    `json:"listener" yaml:"listener"`
 
-	isChain  bool  // True if object is part of an import chain.
-	prepared bool  // True if object has been prepared.
-	err      error // The last error condition encountered during preparation.
+	isChain  bool            // True if object is part of an import chain.
+	prepared bool            // True if object has been prepared.
+	err      error           // The last error condition encountered during preparation.
+	warnings []objectWarning // Soft errors encountered during preparation.
+	stats    objectStats     // The cost of preparing the object.
 }
 
+// objectWarning describes a soft error encountered while preparing an object,
+// such as a file that matched but could not be read. The path identifies the
+// file or directory the error relates to.
+type objectWarning struct {
+	path string
+	err  error
+	dir  bool // True if path is, or may be, a directory that was not walked.
+}
+
+// ErrTimeout is recorded as the error for an object, and any tests that
+// reference it, if preparation of the object was cut off because a time budget
+// expired or the analysis was cancelled.
+var ErrTimeout = errors.New("object preparation timed out")
+
 type genericSource interface {
-	prepare() error
-	getCriteria() []evaluationCriteria
+	prepare(context.Context, *Document) error
+	getCriteria(*Document) []evaluationCriteria
 	isChain() bool
-	expandVariables([]Variable)
+	expandVariables(*Document, []Variable)
 	validate(d *Document) error
 	mergeCriteria([]evaluationCriteria)
-	fireChains(*Document) ([]evaluationCriteria, error)
+	fireChains(context.Context, *Document) ([]evaluationCriteria, error)
 }
 
 func (o *Object) validate(d *Document) error {
@@ -53,6 +77,26 @@ func (o *Object) validate(d *Document) error {
 	return nil
 }
 
+// clone returns a copy of the object with no preparation state.
+func (o *Object) clone() Object {
+	ret := *o
+	ret.isChain = false
+	ret.prepared = false
+	ret.err = nil
+	ret.warnings = nil
+	ret.stats = objectStats{}
+	ret.FileContent.matches = nil
+	ret.FileName.matches = nil
+	ret.Package.pkgInfo = nil
+	ret.HasLine.matches = nil
+	ret.FileStat.matches = nil
+	ret.FileHash.matches = nil
+	ret.ConfigKey.matches = nil
+	ret.Sysctl.matches = nil
+	ret.Listener.matches = nil
+	return ret
+}
+
 func (o *Object) markChain() {
 	o.isChain = o.getSourceInterface().isChain()
 }
@@ -68,11 +112,42 @@ func (o *Object) getSourceInterface() genericSource {
 		return &o.Raw
 	} else if o.HasLine.Path != "" {
 		return &o.HasLine
+	} else if o.FileStat.Path != "" {
+		return &o.FileStat
+	} else if o.FileHash.Path != "" {
+		return &o.FileHash
+	} else if o.ConfigKey.Path != "" {
+		return &o.ConfigKey
+	} else if o.Sysctl.Key != "" || o.Sysctl.Expression != "" {
+		return &o.Sysctl
+	} else if o.Listener.Field != "" {
+		return &o.Listener
 	}
 	return nil
 }
 
-func (o *Object) fireChains(d *Document) error {
+// objectContext returns the context to be used for a preparation step of the
+// object, applying the per-object time budget of the engine if one is set.
+func (o *Object) objectContext(ctx context.Context, d *Document) (context.Context, context.CancelFunc) {
+	e := d.getEngine()
+	if e.objectTimeout > 0 {
+		return context.WithTimeout(ctx, e.objectTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// setError records err as the error for the object. If the error occurred
+// because ctx was cancelled or its deadline expired, ErrTimeout is recorded
+// instead.
+func (o *Object) setError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		err = ErrTimeout
+	}
+	o.err = err
+	return err
+}
+
+func (o *Object) fireChains(ctx context.Context, d *Document) error {
 	si := o.getSourceInterface()
 	// We only fire chains on root object types, not on chain entries
 	// themselves.
@@ -82,13 +157,21 @@ func (o *Object) fireChains(d *Document) error {
 	// If the object already has encountered an error, don't bother
 	// trying to execute chain entries for it.
 	if o.err != nil {
-		debugPrint("fireChains(): skipping failed object \"%v\"\n", o.Object)
+		d.debugPrint("fireChains(): skipping failed object \"%v\"\n", o.Object)
 		return nil
 	}
-	criteria, err := si.fireChains(d)
+	start := time.Now()
+	defer func() {
+		o.stats.prepare += time.Since(start)
+	}()
+	ctx, cancel := o.objectContext(ctx, d)
+	defer cancel()
+	if ctx.Err() != nil {
+		return o.setError(ctx, ctx.Err())
+	}
+	criteria, err := si.fireChains(ctx, d.forObject(o))
 	if err != nil {
-		o.err = err
-		return err
+		return o.setError(ctx, err)
 	}
 	if criteria != nil {
 		si.mergeCriteria(criteria)
@@ -96,9 +179,9 @@ func (o *Object) fireChains(d *Document) error {
 	return nil
 }
 
-func (o *Object) prepare(d *Document) error {
+func (o *Object) prepare(ctx context.Context, d *Document) error {
 	if o.isChain {
-		debugPrint("prepare(): skipping chain object \"%v\"\n", o.Object)
+		d.debugPrint("prepare(): skipping chain object \"%v\"\n", o.Object)
 		return nil
 	}
 	if o.prepared {
@@ -111,11 +194,20 @@ func (o *Object) prepare(d *Document) error {
 		o.err = fmt.Errorf("object has no valid interface")
 		return o.err
 	}
-	p.expandVariables(d.Variables)
-	err := p.prepare()
+	start := time.Now()
+	defer func() {
+		o.stats.prepare += time.Since(start)
+	}()
+	ctx, cancel := o.objectContext(ctx, d)
+	defer cancel()
+	if ctx.Err() != nil {
+		return o.setError(ctx, ctx.Err())
+	}
+	od := d.forObject(o)
+	p.expandVariables(od, d.Variables)
+	err := p.prepare(ctx, od)
 	if err != nil {
-		o.err = err
-		return err
+		return o.setError(ctx, err)
 	}
 	return nil
 }
@@ -8,6 +8,7 @@
 package scribe
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 )
@@ -42,6 +43,7 @@ type Pkg struct {
 type packageInfo struct {
 	Name    string
 	Version string
+	Type    string
 }
 
 func (p *Pkg) isChain() bool {
@@ -61,31 +63,33 @@ func (p *Pkg) validate(d *Document) error {
 	return nil
 }
 
-func (p *Pkg) fireChains(d *Document) ([]evaluationCriteria, error) {
+func (p *Pkg) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
 	return nil, nil
 }
 
 func (p *Pkg) mergeCriteria(c []evaluationCriteria) {
 }
 
-func (p *Pkg) getCriteria() (ret []evaluationCriteria) {
+func (p *Pkg) getCriteria(d *Document) (ret []evaluationCriteria) {
 	for _, x := range p.pkgInfo {
 		n := evaluationCriteria{}
 		n.identifier = x.Name
 		n.testValue = x.Version
+		n.pkgtype = x.Type
 		ret = append(ret, n)
 	}
 	return ret
 }
 
-func newestPackage(r pkgmgrResult) (ret packageInfo, err error) {
+func newestPackage(d *Document, r pkgmgrResult) (ret packageInfo, err error) {
 	var pinfo *pkgmgrInfo
 	for i := range r.results {
 		if pinfo == nil {
 			pinfo = &r.results[i]
 			continue
 		}
-		f, err := evrCompare(EvropLessThan, pinfo.version, r.results[i].version)
+		f, err := evrCompareScheme(d, evrSchemeForType(pinfo.pkgtype), EvropLessThan,
+			pinfo.version, r.results[i].version)
 		if err != nil {
 			return ret, err
 		}
@@ -95,15 +99,22 @@ func newestPackage(r pkgmgrResult) (ret packageInfo, err error) {
 	}
 	ret.Name = pinfo.name
 	ret.Version = pinfo.version
+	ret.Type = pinfo.pkgtype
 	return ret, nil
 }
 
-func (p *Pkg) prepare() error {
-	debugPrint("prepare(): preparing information for package \"%v\"\n", p.Name)
+func (p *Pkg) prepare(ctx context.Context, d *Document) error {
+	d.debugPrint("prepare(): preparing information for package \"%v\"\n", p.Name)
 	p.pkgInfo = make([]packageInfo, 0)
-	ret := getPackage(p.Name, p.CollectMatch)
+	ret, err := d.getEngine().getPackage(ctx, d.pkgCache, p.Name, p.CollectMatch)
+	if err != nil {
+		return err
+	}
+	if d.object != nil {
+		d.object.stats.packageCache += ret.cacheTime
+	}
 	if p.OnlyNewest && len(ret.results) > 0 {
-		pir, err := newestPackage(ret)
+		pir, err := newestPackage(d, ret)
 		if err != nil {
 			return err
 		}
@@ -114,11 +125,12 @@ func (p *Pkg) prepare() error {
 		n := packageInfo{}
 		n.Name = x.name
 		n.Version = x.version
+		n.Type = x.pkgtype
 		p.pkgInfo = append(p.pkgInfo, n)
 	}
 	return nil
 }
 
-func (p *Pkg) expandVariables(v []Variable) {
-	p.Name = variableExpansion(v, p.Name)
+func (p *Pkg) expandVariables(d *Document, v []Variable) {
+	p.Name = variableExpansion(d, v, p.Name)
 }
@@ -8,7 +8,11 @@
 package scribe_test
 
 import (
+	"context"
+	"errors"
 	"github.com/mozilla/scribe"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -132,6 +136,72 @@ var packagePolicyDoc = `
 			"operation": "<",
 			"value": "2.6.32-573.8.1.el6.x86_64"
 		}
+	},
+
+	{
+		"test": "package9",
+		"expectedresult": true,
+		"object": "grub-common-package",
+		"evr": {
+			"operation": "<=",
+			"value": "2.02-beta2"
+		}
+	},
+
+	{
+		"test": "package10",
+		"expectedresult": false,
+		"object": "grub-common-package",
+		"evr": {
+			"operation": "!=",
+			"value": "2.02-beta2"
+		}
+	},
+
+	{
+		"test": "package11",
+		"expectedresult": true,
+		"object": "openssl-package",
+		"evr": {
+			"ranges": [
+			{ "lower": "1.0.1", "lowerinclusive": true, "upper": "1.0.1g" }
+			]
+		}
+	},
+
+	{
+		"test": "package12",
+		"expectedresult": false,
+		"object": "openssl-package",
+		"evr": {
+			"ranges": [
+			{ "lower": "0.9.8", "upper": "0.9.8zh" },
+			{ "lower": "1.0.1e", "upper": "1.0.1g", "upperinclusive": true }
+			]
+		}
+	},
+
+	{
+		"test": "package13",
+		"expectedresult": true,
+		"object": "openssl-package",
+		"evr": {
+			"ranges": [
+			{ "lower": "0.9.8", "upper": "0.9.8zh" },
+			{ "lower": "1.0.1e", "lowerinclusive": true }
+			]
+		}
+	},
+
+	{
+		"test": "package14",
+		"expectedresult": true,
+		"object": "kernel-package-newest",
+		"evr": {
+			"ranges": [
+			{ "upper": "2.6.32-573.8.1.el6.x86_64", "upperinclusive": true }
+			]
+		}
 	}
 	]
 }
@@ -141,6 +211,22 @@ func TestPackagePolicy(t *testing.T) {
 	genericTestExec(t, packagePolicyDoc)
 }
 
+func TestEvrRangesValidation(t *testing.T) {
+	docs := []string{
+		`{"objects": [{"object": "o", "package": {"name": "openssl"}}],
+		"tests": [{"test": "t", "object": "o", "evr": {"ranges": [{}]}}]}`,
+		`{"objects": [{"object": "o", "package": {"name": "openssl"}}],
+		"tests": [{"test": "t", "object": "o", "evr": {"operation": "<",
+		"value": "1.0", "ranges": [{"upper": "1.0"}]}}]}`,
+	}
+	for _, x := range docs {
+		_, err := scribe.LoadDocument(strings.NewReader(x))
+		if err == nil {
+			t.Fatalf("LoadDocument: expected error for %v", x)
+		}
+	}
+}
+
 func TestPackageQuery(t *testing.T) {
 	scribe.Bootstrap()
 	scribe.TestHooks(true)
@@ -152,3 +238,276 @@ func TestPackageQuery(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+// Used in TestPackageSources
+var packageSourcesDoc = `
+{
+	"objects": [
+	{
+		"object": "openssl-package",
+		"package": {
+			"name": "openssl"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "openssl",
+		"object": "openssl-package",
+		"evr": {
+			"operation": "<",
+			"value": "1.0.2"
+		}
+	}
+	]
+}
+`
+
+type failingPackageSource struct{}
+
+func (f failingPackageSource) Name() string {
+	return "failing"
+}
+
+func (f failingPackageSource) Packages(ctx context.Context) ([]scribe.PackageInfo, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestPackageSources(t *testing.T) {
+	fixture := scribe.NewStaticPackageSource("fixture", []scribe.PackageInfo{
+		{Name: "openssl", Version: "1.0.1e", Type: "rpm", Arch: "x86_64"},
+		{Name: "bash", Version: "4.3-11", Type: "rpm", Arch: "x86_64"},
+	})
+	e := scribe.NewEngine(scribe.WithPackageSources(fixture, failingPackageSource{}))
+	pinfo := e.QueryPackages()
+	if len(pinfo) != 2 {
+		t.Fatalf("expected 2 packages, got %v", len(pinfo))
+	}
+	if pinfo[0].Name != "openssl" || pinfo[0].Arch != "x86_64" {
+		t.Fatalf("unexpected package %+v", pinfo[0])
+	}
+
+	doc, err := e.LoadDocument(strings.NewReader(packageSourcesDoc))
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	a, err := e.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	tr, err := a.GetResults("openssl")
+	if err != nil {
+		t.Fatalf("GetResults: %v", err)
+	}
+	if !tr.IsError || tr.Error != "package source failing: database unavailable" {
+		t.Fatalf("openssl: expected package source error, got %+v", tr)
+	}
+	if len(tr.Warnings) != 0 {
+		t.Fatalf("openssl: unexpected warnings %+v", tr.Warnings)
+	}
+}
+
+// changingPackageSource fails the first time it is queried, and afterwards
+// returns openssl at the version set in the source.
+type changingPackageSource struct {
+	sync.Mutex
+	calls   int
+	version string
+}
+
+func (c *changingPackageSource) Name() string {
+	return "changing"
+}
+
+func (c *changingPackageSource) Packages(ctx context.Context) ([]scribe.PackageInfo, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.calls++
+	if c.calls == 1 {
+		return nil, errors.New("database locked")
+	}
+	return []scribe.PackageInfo{{Name: "openssl", Version: c.version, Type: "rpm"}}, nil
+}
+
+func (c *changingPackageSource) setVersion(v string) {
+	c.Lock()
+	defer c.Unlock()
+	c.version = v
+}
+
+func TestPackageCacheLifetime(t *testing.T) {
+	src := &changingPackageSource{version: "1.0.1e"}
+	e := scribe.NewEngine(scribe.WithPackageSources(src))
+	doc, err := e.LoadDocument(strings.NewReader(packageSourcesDoc))
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	analyze := func() scribe.TestResult {
+		a, err := e.Analyze(context.Background(), doc)
+		if err != nil {
+			t.Fatalf("Analyze: %v", err)
+		}
+		tr, err := a.GetResults("openssl")
+		if err != nil {
+			t.Fatalf("GetResults: %v", err)
+		}
+		return tr
+	}
+
+	// A failure of the package source should only affect the analysis
+	// it occurred in.
+	tr := analyze()
+	if !tr.IsError || tr.Error != "package source changing: database locked" {
+		t.Fatalf("expected package source error, got %+v", tr)
+	}
+	tr = analyze()
+	if tr.IsError || !tr.MasterResult {
+		t.Fatalf("expected openssl 1.0.1e to match, got %+v", tr)
+	}
+
+	// Packages upgraded between analyses should be seen by the next one.
+	src.setVersion("1.0.2k")
+	tr = analyze()
+	if tr.IsError || tr.MasterResult {
+		t.Fatalf("expected openssl 1.0.2k not to match, got %+v", tr)
+	}
+}
+
+func TestRegisterPackageSource(t *testing.T) {
+	names := scribe.RegisteredPackageSources()
+	if len(names) < 2 || names[0] != "rpm" || names[1] != "dpkg" {
+		t.Fatalf("unexpected registered package sources %v", names)
+	}
+	err := scribe.RegisterPackageSource(scribe.NewStaticPackageSource("rpm", nil))
+	if err == nil {
+		t.Fatalf("registering duplicate package source should fail")
+	}
+}
+
+func TestDpkgStatusSource(t *testing.T) {
+	all, err := scribe.ReadDpkgStatus(context.Background(), "test/dpkg")
+	if err != nil {
+		t.Fatalf("ReadDpkgStatus: %v", err)
+	}
+	if len(all) != 9 {
+		t.Fatalf("expected 9 status entries, got %v", len(all))
+	}
+
+	e := scribe.NewEngine(scribe.WithPackageSources(scribe.NewDpkgStatusSource("test/dpkg")))
+	pinfo := e.QueryPackages()
+	expect := []scribe.PackageInfo{
+		{"libssl1.0.0", "1.0.2g-1ubuntu4.10", "dpkg", "amd64", "openssl", "install ok installed"},
+		{"libssl1.0.0", "1.0.2g-1ubuntu4.10", "dpkg", "i386", "openssl", "install ok installed"},
+		{"linux-image-extra-4.4.0-116-generic-with-a-very-long-name",
+			"4.4.0-116.140~really4.4.0.116.140+build.ubuntu1", "dpkg", "amd64", "linux",
+			"install ok installed"},
+		{"bash", "4.3-14ubuntu1.2", "dpkg", "amd64", "bash", "install ok installed"},
+		{"openssh-server", "1:7.2p2-4ubuntu2.4", "dpkg", "amd64", "openssh", "hold ok installed"},
+		{"tzdata", "2018e-0+deb9u1", "dpkg", "all", "tzdata", "install ok installed"},
+	}
+	if len(pinfo) != len(expect) {
+		t.Fatalf("expected %v packages, got %v: %+v", len(expect), len(pinfo), pinfo)
+	}
+	for i := range expect {
+		if pinfo[i] != expect[i] {
+			t.Fatalf("package %v: expected %+v, got %+v", i, expect[i], pinfo[i])
+		}
+	}
+
+	e = scribe.NewEngine(scribe.WithPackageSources(scribe.NewDpkgStatusSource("test/nonexistent")))
+	if len(e.QueryPackages()) != 0 {
+		t.Fatalf("expected no packages for missing status database")
+	}
+}
+
+// Used in TestPackageEvrScheme
+var packageEvrSchemeDoc = `
+{
+	"objects": [
+	{
+		"object": "openssl-package",
+		"package": {
+			"name": "libssl1.0.0"
+		}
+	},
+
+	{
+		"object": "app-package",
+		"package": {
+			"name": "app"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "dpkg-by-type",
+		"object": "openssl-package",
+		"evr": {
+			"operation": "<",
+			"value": "1.0.2g-1ubuntu4.11"
+		}
+	},
+
+	{
+		"test": "rpm-by-scheme",
+		"object": "openssl-package",
+		"evr": {
+			"operation": "<",
+			"value": "1.0.2g-1ubuntu4.11",
+			"scheme": "rpm"
+		}
+	},
+
+	{
+		"test": "semver-by-scheme",
+		"object": "app-package",
+		"evr": {
+			"operation": "<",
+			"value": "2.0.0",
+			"scheme": "semver"
+		}
+	}
+	]
+}
+`
+
+func TestPackageEvrScheme(t *testing.T) {
+	e := scribe.NewEngine(scribe.WithPackageSources(
+		scribe.NewStaticPackageSource("fixture", []scribe.PackageInfo{
+			{Name: "libssl1.0.0", Version: "1.0.2g-1ubuntu4.11~rc1", Type: "dpkg"},
+			{Name: "app", Version: "2.0.0-rc.1", Type: "test"},
+		})))
+	doc, err := e.LoadDocument(strings.NewReader(packageEvrSchemeDoc))
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	a, err := e.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	expect := map[string]bool{
+		"dpkg-by-type":     true,
+		"rpm-by-scheme":    false,
+		"semver-by-scheme": true,
+	}
+	for k, v := range expect {
+		tr, err := a.GetResults(k)
+		if err != nil {
+			t.Fatalf("GetResults: %v", err)
+		}
+		if tr.IsError {
+			t.Fatalf("%v: unexpected error %v", k, tr.Error)
+		}
+		if tr.MasterResult != v {
+			t.Fatalf("%v: expected %v, got %v", k, v, tr.MasterResult)
+		}
+	}
+
+	_, err = e.LoadDocument(strings.NewReader(strings.Replace(packageEvrSchemeDoc,
+		`"scheme": "rpm"`, `"scheme": "bad"`, 1)))
+	if err == nil {
+		t.Fatalf("LoadDocument: expected error for invalid scheme")
+	}
+}
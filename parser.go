@@ -9,6 +9,7 @@ package scribe
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,13 +18,33 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// LoadDocument loads a scribe JSON or YAML document from the reader
+// specified by r using the default engine. Returns a Document type that can
+// be passed to AnalyzeDocument(). On error, LoadDocument() returns the error
+// that occurred.
+func LoadDocument(r io.Reader) (Document, error) {
+	return defaultEngine.LoadDocument(r)
+}
+
+// AnalyzeDocument analyzes a scribe document on the host system using the
+// default engine. See Engine.AnalyzeDocument for details.
+func AnalyzeDocument(d Document) error {
+	return defaultEngine.AnalyzeDocument(d)
+}
+
+// AnalyzeDocumentContext analyzes a scribe document on the host system using
+// the default engine. See Engine.AnalyzeDocumentContext for details.
+func AnalyzeDocumentContext(ctx context.Context, d Document) error {
+	return defaultEngine.AnalyzeDocumentContext(ctx, d)
+}
+
 // LoadDocument loads a scribe JSON or YAML document from the reader
 // specified by r. Returns a Document type that can be passed to
 // AnalyzeDocument(). On error, LoadDocument() returns the error that occurred.
-func LoadDocument(r io.Reader) (Document, error) {
+func (e *Engine) LoadDocument(r io.Reader) (Document, error) {
 	var ret Document
 
-	debugPrint("loading new document\n")
+	e.debugPrint("loading new document\n")
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return ret, err
@@ -35,25 +56,26 @@ func LoadDocument(r io.Reader) (Document, error) {
 	}
 	switch b[0] {
 	case '{', '[':
-		debugPrint("document is in JSON format\n")
+		e.debugPrint("document is in JSON format\n")
 		err = json.Unmarshal(b, &ret)
 	default:
-		debugPrint("document is in YAML format\n")
+		e.debugPrint("document is in YAML format\n")
 		err = yaml.Unmarshal(b, &ret)
 	}
 	if err != nil {
 		return ret, err
 	}
-	debugPrint("new document has %v test(s)\n", len(ret.Tests))
-	debugPrint("new document has %v object(s)\n", len(ret.Objects))
-	debugPrint("new document has %v variable(s)\n", len(ret.Variables))
-	debugPrint("loaded: %+v\n", ret)
+	e.debugPrint("new document has %v test(s)\n", len(ret.Tests))
+	e.debugPrint("new document has %v object(s)\n", len(ret.Objects))
+	e.debugPrint("new document has %v variable(s)\n", len(ret.Variables))
+	e.debugPrint("loaded: %+v\n", ret)
 
-	debugPrint("validating document...\n")
+	e.debugPrint("validating document...\n")
 	err = ret.Validate()
 	if err != nil {
 		return ret, err
 	}
+	ret.engine = e
 
 	return ret, nil
 }
@@ -65,12 +87,18 @@ func LoadDocument(r io.Reader) (Document, error) {
 // Note that an error in an individual test does not necessarily represent
 // a fatal error condition. In these cases, the test itself will be marked
 // as having an error condition (stored in the Err field of the Test).
-func AnalyzeDocument(d Document) error {
-	debugPrint("preparing objects...\n")
-	err := d.prepareObjects()
-	if err != nil {
-		return err
-	}
-	debugPrint("analyzing document...\n")
-	return d.runTests()
+//
+// The document is not modified, so the results are only available through
+// the expected result callback of the engine. To obtain the results of each
+// test, use Analyze instead.
+func (e *Engine) AnalyzeDocument(d Document) error {
+	return e.AnalyzeDocumentContext(context.Background(), d)
+}
+
+// AnalyzeDocumentContext is like AnalyzeDocument, but preparation of objects
+// is abandoned if ctx is cancelled or the document time budget of the engine
+// expires. See Analyze for details.
+func (e *Engine) AnalyzeDocumentContext(ctx context.Context, d Document) error {
+	_, err := e.Analyze(ctx, d)
+	return err
 }
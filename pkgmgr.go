@@ -8,16 +8,18 @@
 package scribe
 
 import (
+	"context"
+	"fmt"
 	"os/exec"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
-var pkgmgrInitialized bool
-var pkgmgrCache []pkgmgrInfo
-
 type pkgmgrResult struct {
-	results []pkgmgrInfo
+	results   []pkgmgrInfo
+	cacheTime time.Duration // Time spent waiting for the package cache.
 }
 
 type pkgmgrInfo struct {
@@ -25,38 +27,93 @@ type pkgmgrInfo struct {
 	version string
 	pkgtype string
 	arch    string
+	source  string
+	status  string
 }
 
 // PackageInfo stores information from the system as returned by QueryPackages().
 type PackageInfo struct {
-	Name    string `json:"name" yaml:"name"`       // Package name.
-	Version string `json:"version" yaml:"version"` // Package version.
-	Type    string `json:"type" yaml:"type"`       // Package type.
-	Arch    string `json:"arch" yaml:"arch"`       // Package architecture
+	Name    string `json:"name" yaml:"name"`                         // Package name.
+	Version string `json:"version" yaml:"version"`                   // Package version.
+	Type    string `json:"type" yaml:"type"`                         // Package type.
+	Arch    string `json:"arch" yaml:"arch"`                         // Package architecture
+	Source  string `json:"source,omitempty" yaml:"source,omitempty"` // Source package name, if known.
+	Status  string `json:"status,omitempty" yaml:"status,omitempty"` // Package manager status, if known.
 }
 
-// QueryPackages will query packages on the system, returning a slice of all
-// identified packages in PackageInfo form.
+// QueryPackages will query packages on the system using the default engine,
+// returning a slice of all identified packages in PackageInfo form.
 func QueryPackages() []PackageInfo {
+	return defaultEngine.QueryPackages()
+}
+
+// QueryPackages will query packages on the system, returning a slice of all
+// identified packages in PackageInfo form. The package sources are queried
+// each time QueryPackages is called. If a package source fails, the packages
+// returned by the remaining sources are included.
+func (e *Engine) QueryPackages() []PackageInfo {
 	ret := make([]PackageInfo, 0)
-	for _, x := range getAllPackages().results {
+	all, _ := e.getAllPackages(context.Background(), nil)
+	for _, x := range all.results {
 		np := PackageInfo{}
 		np.Name = x.name
 		np.Version = x.version
 		np.Type = x.pkgtype
 		np.Arch = x.arch
+		np.Source = x.source
+		np.Status = x.status
 		ret = append(ret, np)
 	}
 	return ret
 }
 
-func getPackage(name string, collectexp string) (ret pkgmgrResult) {
+// packageCache holds the packages reported by the package sources during a
+// single analysis, so the sources are only queried once regardless of how
+// many package objects the document contains. A new cache is used for each
+// analysis, so packages installed or upgraded between analyses are seen.
+type packageCache struct {
+	sync.Mutex
+	initialized bool
+	packages    []pkgmgrInfo
+}
+
+// getPackageCache returns the packages in cache pc, querying the package
+// sources of the engine first if required. If pc is nil, the package sources
+// are always queried.
+//
+// If a package source fails, the packages from the remaining sources are
+// returned along with the error from the source, and the cache is left
+// uninitialized so the sources are queried again by the next object that
+// needs them. An error is also returned if ctx is cancelled while the sources
+// are being queried.
+func (e *Engine) getPackageCache(ctx context.Context, pc *packageCache) ([]pkgmgrInfo, error) {
+	if pc == nil {
+		return e.pkgmgrInit(ctx)
+	}
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.initialized {
+		return pc.packages, nil
+	}
+	pkgs, err := e.pkgmgrInit(ctx)
+	if err != nil {
+		return pkgs, err
+	}
+	pc.packages = pkgs
+	pc.initialized = true
+	return pkgs, nil
+}
+
+func (e *Engine) getPackage(ctx context.Context, pc *packageCache, name string, collectexp string) (ret pkgmgrResult, err error) {
 	ret.results = make([]pkgmgrInfo, 0)
-	if !pkgmgrInitialized {
-		pkgmgrInit()
+	start := time.Now()
+	cache, err := e.getPackageCache(ctx, pc)
+	if err != nil {
+		return ret, err
 	}
-	debugPrint("getPackage(): looking for \"%v\"\n", name)
-	for _, x := range pkgmgrCache {
+	ret.cacheTime = time.Since(start)
+	e.debugPrint("getPackage(): looking for \"%v\"\n", name)
+	for _, x := range cache {
 		if collectexp == "" {
 			if x.name != name {
 				continue
@@ -67,92 +124,135 @@ func getPackage(name string, collectexp string) (ret pkgmgrResult) {
 				continue
 			}
 		}
-		debugPrint("getPackage(): found %v, %v, %v\n", x.name, x.version, x.pkgtype)
+		e.debugPrint("getPackage(): found %v, %v, %v\n", x.name, x.version, x.pkgtype)
 		ret.results = append(ret.results, x)
 	}
-	debugPrint("getPackage(): returning %v entries\n", len(ret.results))
+	e.debugPrint("getPackage(): returning %v entries\n", len(ret.results))
 	return
 }
 
-func getAllPackages() pkgmgrResult {
+func (e *Engine) getAllPackages(ctx context.Context, pc *packageCache) (pkgmgrResult, error) {
 	ret := pkgmgrResult{}
 	ret.results = make([]pkgmgrInfo, 0)
-	if !pkgmgrInitialized {
-		pkgmgrInit()
-	}
-	for _, x := range pkgmgrCache {
+	cache, err := e.getPackageCache(ctx, pc)
+	for _, x := range cache {
 		ret.results = append(ret.results, x)
 	}
-	return ret
+	return ret, err
 }
 
-func pkgmgrInit() {
-	debugPrint("pkgmgrInit(): initializing package manager...\n")
-	pkgmgrCache = make([]pkgmgrInfo, 0)
-	if sRuntime.testHooks {
-		pkgmgrCache = append(pkgmgrCache, testGetPackages()...)
-	} else {
-		pkgmgrCache = append(pkgmgrCache, rpmGetPackages()...)
-		pkgmgrCache = append(pkgmgrCache, dpkgGetPackages()...)
+// packageSources returns the package sources in use by the engine.
+func (e *Engine) packageSources() []PackageSource {
+	if e.pkgSources != nil {
+		return e.pkgSources
+	}
+	if e.testHooks {
+		return []PackageSource{testPackageSource}
 	}
-	pkgmgrInitialized = true
-	debugPrint("pkgmgrInit(): initialized with %v packages\n", len(pkgmgrCache))
+	return registeredPackageSources()
 }
 
-func rpmGetPackages() []pkgmgrInfo {
+// pkgmgrInit queries the package sources of the engine, returning the
+// packages they report. If ctx is cancelled while package information is
+// being collected, no packages are returned along with the error from ctx.
+//
+// An error returned by an individual package source does not prevent the
+// remaining sources from being queried. The packages from the other sources
+// are returned along with the first such error, so package objects report the
+// failure as an error, since the package list they would be evaluated against
+// is incomplete.
+func (e *Engine) pkgmgrInit(ctx context.Context) ([]pkgmgrInfo, error) {
+	e.debugPrint("pkgmgrInit(): initializing package manager...\n")
 	ret := make([]pkgmgrInfo, 0)
+	var srcerr error
+	for _, src := range e.packageSources() {
+		pkgs, err := src.Packages(ctx)
+		if ctx.Err() != nil {
+			e.debugPrint("pkgmgrInit(): %v\n", ctx.Err())
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			e.debugPrint("pkgmgrInit(): package source %v: %v\n", src.Name(), err)
+			if srcerr == nil {
+				srcerr = fmt.Errorf("package source %v: %v", src.Name(), err)
+			}
+			continue
+		}
+		e.debugPrint("pkgmgrInit(): package source %v returned %v packages\n", src.Name(), len(pkgs))
+		for _, x := range pkgs {
+			newpkg := pkgmgrInfo{}
+			newpkg.name = x.Name
+			newpkg.version = x.Version
+			newpkg.pkgtype = x.Type
+			newpkg.arch = x.Arch
+			newpkg.source = x.Source
+			newpkg.status = x.Status
+			ret = append(ret, newpkg)
+		}
+	}
+	e.debugPrint("pkgmgrInit(): initialized with %v packages\n", len(ret))
+	return ret, srcerr
+}
 
-	c := exec.Command("rpm", "-qa", "--queryformat", "%{NAME} %{EVR} %{ARCH}\\n")
-	buf, err := c.Output()
+func init() {
+	err := RegisterPackageSource(&commandPackageSource{name: "rpm", query: rpmGetPackages})
+	if err != nil {
+		panic(err)
+	}
+	err = RegisterPackageSource(NewDpkgStatusSource("/"))
 	if err != nil {
-		return ret
+		panic(err)
 	}
+}
 
-	slist := strings.Split(string(buf), "\n")
-	for _, x := range slist {
-		s := strings.Fields(x)
+// commandPackageSource is a PackageSource that obtains package information by
+// executing a package manager command on the system.
+type commandPackageSource struct {
+	name  string
+	query func(context.Context) ([]PackageInfo, error)
+}
 
-		if len(s) < 3 {
-			continue
+func (c *commandPackageSource) Name() string {
+	return c.name
+}
+
+func (c *commandPackageSource) Packages(ctx context.Context) ([]PackageInfo, error) {
+	ret, err := c.query(ctx)
+	if err != nil {
+		// If the package manager is not installed, the source just
+		// does not apply to this system.
+		if ee, ok := err.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
+			return nil, nil
 		}
-		newpkg := pkgmgrInfo{}
-		newpkg.name = s[0]
-		newpkg.version = s[1]
-		newpkg.arch = s[2]
-		newpkg.pkgtype = "rpm"
-		ret = append(ret, newpkg)
+		return nil, err
 	}
-	return ret
+	return ret, nil
 }
 
-func dpkgGetPackages() []pkgmgrInfo {
-	ret := make([]pkgmgrInfo, 0)
+func rpmGetPackages(ctx context.Context) ([]PackageInfo, error) {
+	ret := make([]PackageInfo, 0)
 
-	c := exec.Command("dpkg", "-l")
+	c := exec.CommandContext(ctx, "rpm", "-qa", "--queryformat", "%{NAME} %{EVR} %{ARCH}\\n")
 	buf, err := c.Output()
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	slist := strings.Split(string(buf), "\n")
 	for _, x := range slist {
 		s := strings.Fields(x)
 
-		if len(s) < 4 {
-			continue
-		}
-		// Only process packages that have been fully installed.
-		if s[0] != "ii" {
+		if len(s) < 3 {
 			continue
 		}
-		newpkg := pkgmgrInfo{}
-		newpkg.name = s[1]
-		newpkg.version = s[2]
-		newpkg.arch = s[3]
-		newpkg.pkgtype = "dpkg"
+		newpkg := PackageInfo{}
+		newpkg.Name = s[0]
+		newpkg.Version = s[1]
+		newpkg.Arch = s[2]
+		newpkg.Type = "rpm"
 		ret = append(ret, newpkg)
 	}
-	return ret
+	return ret, nil
 }
 
 // Functions and data related to package tests
@@ -170,13 +270,17 @@ var testPkgTable = []struct {
 	{"kernel", "2.6.32-573.8.1.el6.x86_64"},
 }
 
-func testGetPackages() []pkgmgrInfo {
-	ret := make([]pkgmgrInfo, 0)
+// testPackageSource is used in place of the registered package sources if
+// test hooks are enabled.
+var testPackageSource = NewStaticPackageSource("test", testGetPackages())
+
+func testGetPackages() []PackageInfo {
+	ret := make([]PackageInfo, 0)
 	for _, x := range testPkgTable {
-		newpkg := pkgmgrInfo{}
-		newpkg.name = x.name
-		newpkg.version = x.ver
-		newpkg.pkgtype = "test"
+		newpkg := PackageInfo{}
+		newpkg.Name = x.name
+		newpkg.Version = x.ver
+		newpkg.Type = "test"
 		ret = append(ret, newpkg)
 	}
 	return ret
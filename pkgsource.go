@@ -0,0 +1,95 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// PackageSource is a source of information about packages installed on the
+// system. Package objects in a document are evaluated against the combined
+// list of packages returned by each package source in use by the engine.
+//
+// Name returns a short name for the source, such as "rpm". Packages returns
+// the packages known to the source; if the source does not apply to the
+// system (for example the package manager is not installed) it should return
+// an empty list rather than an error. Packages must respect cancellation of
+// ctx.
+type PackageSource interface {
+	Name() string
+	Packages(ctx context.Context) ([]PackageInfo, error)
+}
+
+var (
+	pkgSourceLock     sync.Mutex
+	pkgSourceRegistry []PackageSource
+)
+
+// RegisterPackageSource adds s to the registry of package sources. Unless an
+// engine is created with the WithPackageSources option, it will collect
+// package information from all registered sources, in the order they were
+// registered. The rpm and dpkg package sources are registered by default.
+// An error is returned if a source with the same name is already registered.
+func RegisterPackageSource(s PackageSource) error {
+	pkgSourceLock.Lock()
+	defer pkgSourceLock.Unlock()
+	for _, x := range pkgSourceRegistry {
+		if x.Name() == s.Name() {
+			return fmt.Errorf("package source %v already registered", s.Name())
+		}
+	}
+	pkgSourceRegistry = append(pkgSourceRegistry, s)
+	return nil
+}
+
+// RegisteredPackageSources returns the names of all registered package
+// sources.
+func RegisteredPackageSources() []string {
+	pkgSourceLock.Lock()
+	defer pkgSourceLock.Unlock()
+	ret := make([]string, 0)
+	for _, x := range pkgSourceRegistry {
+		ret = append(ret, x.Name())
+	}
+	return ret
+}
+
+func registeredPackageSources() []PackageSource {
+	pkgSourceLock.Lock()
+	defer pkgSourceLock.Unlock()
+	ret := make([]PackageSource, len(pkgSourceRegistry))
+	copy(ret, pkgSourceRegistry)
+	return ret
+}
+
+type staticPackageSource struct {
+	name string
+	pkgs []PackageInfo
+}
+
+// NewStaticPackageSource returns a PackageSource named name that always
+// returns the packages in pkgs. This can be used to evaluate documents against
+// a known package inventory, or to supply test fixtures.
+func NewStaticPackageSource(name string, pkgs []PackageInfo) PackageSource {
+	ret := &staticPackageSource{name: name}
+	ret.pkgs = make([]PackageInfo, len(pkgs))
+	copy(ret.pkgs, pkgs)
+	return ret
+}
+
+func (s *staticPackageSource) Name() string {
+	return s.name
+}
+
+func (s *staticPackageSource) Packages(ctx context.Context) ([]PackageInfo, error) {
+	ret := make([]PackageInfo, len(s.pkgs))
+	copy(ret, s.pkgs)
+	return ret, nil
+}
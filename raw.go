@@ -8,6 +8,7 @@
 package scribe
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -30,7 +31,7 @@ func (r *Raw) isChain() bool {
 	return false
 }
 
-func (r *Raw) fireChains(d *Document) ([]evaluationCriteria, error) {
+func (r *Raw) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
 	return nil, nil
 }
 
@@ -49,7 +50,7 @@ func (r *Raw) validate(d *Document) error {
 	return nil
 }
 
-func (r *Raw) getCriteria() []evaluationCriteria {
+func (r *Raw) getCriteria(d *Document) []evaluationCriteria {
 	ret := make([]evaluationCriteria, 0)
 	for _, x := range r.Identifiers {
 		nc := evaluationCriteria{}
@@ -60,9 +61,9 @@ func (r *Raw) getCriteria() []evaluationCriteria {
 	return ret
 }
 
-func (r *Raw) prepare() error {
+func (r *Raw) prepare(ctx context.Context, d *Document) error {
 	return nil
 }
 
-func (r *Raw) expandVariables(v []Variable) {
+func (r *Raw) expandVariables(d *Document, v []Variable) {
 }
@@ -8,6 +8,7 @@
 package scribe
 
 import (
+	"fmt"
 	"regexp"
 )
 
@@ -16,14 +17,16 @@ type Regex struct {
 	Value string `json:"value,omitempty" yaml:"value,omitempty"`
 }
 
-func (r *Regex) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
+func (r *Regex) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
 	var re *regexp.Regexp
-	debugPrint("evaluate(): regexp %v \"%v\", \"%v\"\n", c.identifier, c.testValue, r.Value)
+	d.debugPrint("evaluate(): regexp %v \"%v\", \"%v\"\n", c.identifier, c.testValue, r.Value)
 	re, err = regexp.Compile(r.Value)
 	if err != nil {
 		return
 	}
 	ret.criteria = c
+	ret.evaluator = "regexp"
+	ret.expression = fmt.Sprintf("%v =~ %v", c.testValue, r.Value)
 	if re.MatchString(c.testValue) {
 		ret.result = true
 	}
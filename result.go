@@ -21,13 +21,27 @@ type TestResult struct {
 	Description string    `json:"description" yaml:"description"`       // Test description
 	Tags        []TestTag `json:"tags,omitempty" yaml:"tags,omitempty"` // Tags for the test.
 
-	IsError bool   `json:"iserror" yaml:"iserror"` // True of error is encountered during evaluation.
-	Error   string `json:"error" yaml:"error"`     // Error associated with test.
+	IsError   bool   `json:"iserror" yaml:"iserror"`                         // True of error is encountered during evaluation.
+	IsTimeout bool   `json:"istimeout,omitempty" yaml:"istimeout,omitempty"` // True if the error was ErrTimeout.
+	Error     string `json:"error" yaml:"error"`                             // Error associated with test.
 
-	MasterResult   bool `json:"masterresult" yaml:"masterresult"`     // Master result of test.
-	HasTrueResults bool `json:"hastrueresults" yaml:"hastrueresults"` // True if > 0 evaluations resulted in true.
+	Status         TestStatus `json:"status" yaml:"status"`                 // Outcome of the test, e.g. notapplicable.
+	MasterResult   bool       `json:"masterresult" yaml:"masterresult"`     // Master result of test.
+	HasTrueResults bool       `json:"hastrueresults" yaml:"hastrueresults"` // True if > 0 evaluations resulted in true.
 
 	Results []TestSubResult `json:"results" yaml:"results"` // The sub-results for the test.
+
+	Warnings []TestWarning `json:"warnings,omitempty" yaml:"warnings,omitempty"` // Warnings from object preparation.
+
+	Timing *TestTiming `json:"timing,omitempty" yaml:"timing,omitempty"` // The cost of the test, if profiling.
+}
+
+// TestWarning describes a soft error that occurred while preparing the object
+// referenced by a test, for example a file that could not be read. A warning
+// indicates the result of the test may be incomplete.
+type TestWarning struct {
+	Path  string `json:"path" yaml:"path"`   // The file or directory the warning relates to.
+	Error string `json:"error" yaml:"error"` // The error that occurred.
 }
 
 // TestSubResult describes a sub-result for a test.
@@ -35,14 +49,30 @@ type TestResult struct {
 // For a given test, a number of sources can be identified that match the
 // criteria. For example, multiple files can be identified with a given
 // filename. Each test tracks individual results for these cases.
+//
+// Each sub-result also includes the evidence used to reach the result; the
+// value that was evaluated, the evaluator that was applied and a description
+// of the comparison made (for example "1.0.1e < 1.0.2k"). Where the value
+// was obtained from a file, Line contains the line number it was found on.
 type TestSubResult struct {
-	Result     bool   `json:"result" yaml:"result"`         // The result of evaluation for an identifier source.
-	Identifier string `json:"identifier" yaml:"identifier"` // The identifier for the source.
+	Result     bool   `json:"result" yaml:"result"`                 // The result of evaluation for an identifier source.
+	Identifier string `json:"identifier" yaml:"identifier"`         // The identifier for the source.
+	Value      string `json:"value" yaml:"value"`                   // The value that was evaluated.
+	Evaluator  string `json:"evaluator" yaml:"evaluator"`           // The evaluator applied to the value.
+	Expression string `json:"expression" yaml:"expression"`         // The comparison that was made.
+	Line       int    `json:"line,omitempty" yaml:"line,omitempty"` // Line number the value was found on.
 }
 
 // GetResults returns test results for a given test. Returns an error if for
 // some reason the results can not be returned.
+//
+// A document is not modified when it is analyzed, so GetResults returns an
+// error for a document returned by LoadDocument; the results of an analysis
+// must be obtained using Analysis.GetResults.
 func GetResults(d *Document, name string) (TestResult, error) {
+	if !d.analyzed {
+		return TestResult{}, fmt.Errorf("document has not been analyzed, use Analysis.GetResults")
+	}
 	t, err := d.GetTest(name)
 	if err != nil {
 		return TestResult{}, err
@@ -52,17 +82,35 @@ func GetResults(d *Document, name string) (TestResult, error) {
 	ret.TestName = t.TestName
 	ret.Description = t.Description
 	ret.Tags = t.Tags
+	if d.getEngine().profiling {
+		timing := t.timing(d)
+		ret.Timing = &timing
+	}
+	obj, err := d.getObject(t.Object)
+	if err == nil {
+		for _, x := range obj.warnings {
+			nw := TestWarning{Path: x.path, Error: fmt.Sprintf("%v", x.err)}
+			ret.Warnings = append(ret.Warnings, nw)
+		}
+	}
 	if t.err != nil {
 		ret.Error = fmt.Sprintf("%v", t.err)
+		ret.Status = StatusError
 		ret.IsError = true
+		ret.IsTimeout = t.err == ErrTimeout
 		return ret, nil
 	}
+	ret.Status = t.status
 	ret.MasterResult = t.masterResult
 	ret.HasTrueResults = t.hasTrueResults
 	for _, x := range t.results {
 		nr := TestSubResult{}
 		nr.Result = x.result
 		nr.Identifier = x.criteria.identifier
+		nr.Value = x.criteria.testValue
+		nr.Evaluator = x.evaluator
+		nr.Expression = x.expression
+		nr.Line = x.criteria.line
 		ret.Results = append(ret.Results, nr)
 	}
 	return ret, nil
@@ -86,8 +134,8 @@ func (r *TestResult) SingleLineResults() []string {
 	if r.TestName != "" {
 		namestr = r.TestName
 	}
-	buf := fmt.Sprintf("master %v name:\"%v\" id:\"%v\" hastrue:%v error:\"%v\"",
-		rs, namestr, r.TestID, r.HasTrueResults, r.Error)
+	buf := fmt.Sprintf("master %v name:\"%v\" id:\"%v\" status:%v hastrue:%v error:\"%v\"",
+		rs, namestr, r.TestID, r.Status, r.HasTrueResults, r.Error)
 	lns = append(lns, buf)
 
 	for _, x := range r.Results {
@@ -96,8 +144,17 @@ func (r *TestResult) SingleLineResults() []string {
 		} else {
 			rs = "[false]"
 		}
-		buf := fmt.Sprintf("sub %v name:\"%v\" id:\"%v\" identifier:\"%v\"",
-			rs, namestr, r.TestID, x.Identifier)
+		buf := fmt.Sprintf("sub %v name:\"%v\" id:\"%v\" identifier:\"%v\" value:\"%v\" evaluator:\"%v\" expression:\"%v\"",
+			rs, namestr, r.TestID, x.Identifier, x.Value, x.Evaluator, x.Expression)
+		if x.Line != 0 {
+			buf += fmt.Sprintf(" line:%v", x.Line)
+		}
+		lns = append(lns, buf)
+	}
+
+	for _, x := range r.Warnings {
+		buf := fmt.Sprintf("warning name:\"%v\" id:\"%v\" path:\"%v\" error:\"%v\"",
+			namestr, r.TestID, x.Path, x.Error)
 		lns = append(lns, buf)
 	}
 
@@ -131,11 +188,15 @@ func (r *TestResult) String() string {
 		lns = append(lns, "\tmaster result: true")
 	} else {
 		buf := "\tmaster result: false"
-		if r.HasTrueResults {
-			buf = buf + ", has true results, failure caused by dependency"
+		if r.Status == StatusSkipped {
+			if r.HasTrueResults {
+				buf = buf + ", has true results"
+			}
+			buf = buf + ", failure caused by dependency"
 		}
 		lns = append(lns, buf)
 	}
+	lns = append(lns, fmt.Sprintf("\tstatus: %v", r.Status))
 	if len(r.Tags) > 0 {
 		for _, x := range r.Tags {
 			lns = append(lns, fmt.Sprintf("\ttag: %v: %v", x.Key, x.Value))
@@ -145,8 +206,21 @@ func (r *TestResult) String() string {
 		buf := fmt.Sprintf("\t[error] error: %v", r.Error)
 		lns = append(lns, buf)
 	}
+	for _, x := range r.Warnings {
+		buf := fmt.Sprintf("\t[warning] %v: %v", x.Path, x.Error)
+		lns = append(lns, buf)
+	}
 	for _, x := range r.Results {
 		buf := fmt.Sprintf("\t[%v] identifier: \"%v\"", x.Result, x.Identifier)
+		if x.Line != 0 {
+			buf += fmt.Sprintf(" line: %v", x.Line)
+		}
+		buf += fmt.Sprintf(" value: \"%v\"", x.Value)
+		if x.Expression != "" {
+			buf += fmt.Sprintf(" (%v: %v)", x.Evaluator, x.Expression)
+		} else {
+			buf += fmt.Sprintf(" (%v)", x.Evaluator)
+		}
 		lns = append(lns, buf)
 	}
 	return strings.Join(lns, "\n")
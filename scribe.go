@@ -9,29 +9,14 @@
 package scribe
 
 import (
-	"fmt"
 	"io"
 )
 
-type runtime struct {
-	debugging   bool
-	debugWriter io.Writer
-	excall      func(TestResult)
-	testHooks   bool
-	fileLocator func(string, bool, string, int) ([]string, error)
-}
-
 // Version is the scribe library version
 const Version = "0.5"
 
-var sRuntime runtime
-
-func (r *runtime) initialize() {
-}
-
-func init() {
-	sRuntime.initialize()
-}
+// defaultEngine is the Engine used by the package level functions.
+var defaultEngine = NewEngine()
 
 // Bootstrap the scribe library. This function is currently not used but code
 // should call this function before any other functions in the library. An
@@ -43,49 +28,68 @@ func Bootstrap() (err error) {
 	return err
 }
 
-// ExpectedCallback can be used to set a callback function for test results.
+// ExpectedCallback can be used to set a callback function for test results
+// on the default engine.
 //
 // Set an expected result callback. f should be a function that takes a TestResult
 // type as an argument. When this is set, if the result of a test does not
 // match the value set in "expectedresult" for the test, the function is
 // immediately called with the applicable TestResult as an argument.
 func ExpectedCallback(f func(TestResult)) {
-	sRuntime.excall = f
+	defaultEngine.excall = f
 }
 
-// InstallFileLocator installs alternate file walking functions.
+// InstallFileLocator installs alternate file walking functions on the default
+// engine.
 //
 // Install an alternate file location function. This overrides use of the
 // SimpleFileLocator locate() function, and allows specification of an
 // alternate function to use for locating candidate files on the filesystem.
 //
 // This function is primarily used within the scribe mig module to make use
-// of the file module traversal function.
+// of the file module traversal function. The default engine prepares objects
+// one at a time, so f is never called concurrently.
+//
+// The maximum search depth for the object is passed to f; any other locator
+// options set in the object are not available to f. Use
+// InstallFileLocatorWithOptions to install a function that receives all
+// locator options.
 func InstallFileLocator(f func(string, bool, string, int) ([]string, error)) {
-	sRuntime.fileLocator = f
+	defaultEngine.fileLocator = func(target string, useRegexp bool, root string, opts LocatorOptions) ([]string, error) {
+		return f(target, useRegexp, root, opts.MaxDepth)
+	}
 }
 
-// TestHooks enables or disables testing hooks in the library.
+// InstallFileLocatorWithOptions installs alternate file walking functions on
+// the default engine. It is the same as InstallFileLocator, except that f
+// receives all of the locator options specified in the object.
+func InstallFileLocatorWithOptions(f FileLocator) {
+	defaultEngine.fileLocator = f
+}
+
+// SetProfiling enables or disables profiling on the default engine.
+//
+// If profiling is enabled, the Timing field of each TestResult is filled in
+// with the cost of the test. It is disabled by default, so the results of
+// analyzing the same document do not differ between runs; the cost of an
+// analysis is always available using Analysis.Summary.
+func SetProfiling(f bool) {
+	defaultEngine.profiling = f
+}
+
+// TestHooks enables or disables testing hooks on the default engine.
 //
 // Enable or disable test hooks. If test hooks are enabled, certain functions
 // such as requesting package data from the host system are bypassed in favor
 // of test tables.
 func TestHooks(f bool) {
-	sRuntime.testHooks = f
-}
-
-func debugPrint(s string, args ...interface{}) {
-	if !sRuntime.debugging {
-		return
-	}
-	buf := fmt.Sprintf(s, args...)
-	fmt.Fprintf(sRuntime.debugWriter, "[scribe] %v", buf)
+	defaultEngine.testHooks = f
 }
 
-// SetDebug enables or disables debugging. If debugging is enabled, output is written
-// to the io.Writer specified by w.
+// SetDebug enables or disables debugging on the default engine. If debugging
+// is enabled, output is written to the io.Writer specified by w.
 func SetDebug(f bool, w io.Writer) {
-	sRuntime.debugging = f
-	sRuntime.debugWriter = w
-	debugPrint("debugging enabled\n")
+	defaultEngine.debugging = f
+	defaultEngine.debugWriter = w
+	defaultEngine.debugPrint("debugging enabled\n")
 }
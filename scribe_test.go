@@ -8,9 +8,13 @@
 package scribe_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mozilla/scribe"
 )
@@ -43,15 +47,15 @@ tests:
 		return
 	}
 	// Analyze the document.
-	err = scribe.AnalyzeDocument(doc)
+	a, err := scribe.Analyze(context.Background(), doc)
 	if err != nil {
-		fmt.Println("AnalyzeDocument:", err)
+		fmt.Println("Analyze:", err)
 		return
 	}
 	// Grab the results for the test, most of the time you would loop
 	// through the results of GetTestIdentifiers() rather then call a result
 	// directly.
-	result, err := scribe.GetResults(&doc, "example")
+	result, err := a.GetResults("example")
 	if err != nil {
 		fmt.Println("GetResults:", err)
 		return
@@ -94,7 +98,7 @@ var resultsFormattingDoc = `
 }
 `
 
-func genericTestExec(t *testing.T, documentStr string) *scribe.Document {
+func genericTestExec(t *testing.T, documentStr string) *scribe.Analysis {
 	rdr := strings.NewReader(documentStr)
 	scribe.Bootstrap()
 	scribe.TestHooks(true)
@@ -102,9 +106,9 @@ func genericTestExec(t *testing.T, documentStr string) *scribe.Document {
 	if err != nil {
 		t.Fatalf("scribe.LoadDocument: %v", err)
 	}
-	err = scribe.AnalyzeDocument(doc)
+	a, err := scribe.Analyze(context.Background(), doc)
 	if err != nil {
-		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+		t.Fatalf("scribe.Analyze: %v", err)
 	}
 	// Get results for each test and make sure the result matches what
 	// expectedresult is set to
@@ -114,7 +118,7 @@ func genericTestExec(t *testing.T, documentStr string) *scribe.Document {
 		if err != nil {
 			t.Fatalf("Document.GetTest: %v", err)
 		}
-		sres, err := scribe.GetResults(&doc, x)
+		sres, err := a.GetResults(x)
 		if err != nil {
 			t.Fatalf("scribe.GetResults: %v", err)
 		}
@@ -131,7 +135,7 @@ func genericTestExec(t *testing.T, documentStr string) *scribe.Document {
 			}
 		}
 	}
-	return &doc
+	return a
 }
 
 func TestResultsFormatting(t *testing.T) {
@@ -142,11 +146,11 @@ func TestResultsFormatting(t *testing.T) {
 	if err != nil {
 		t.Fatalf("scribe.LoadDocument: %v", err)
 	}
-	err = scribe.AnalyzeDocument(doc)
+	a, err := scribe.Analyze(context.Background(), doc)
 	if err != nil {
-		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+		t.Fatalf("scribe.Analyze: %v", err)
 	}
-	res, err := scribe.GetResults(&doc, "test1")
+	res, err := a.GetResults("test1")
 	if err != nil {
 		t.Fatalf("scribe.GetResults: %v", err)
 	}
@@ -155,22 +159,548 @@ func TestResultsFormatting(t *testing.T) {
 	if len(slr) != 2 {
 		t.Fatalf("single line results incorrect line count")
 	}
-	if slr[0] != "master [true] name:\"a test\" id:\"test1\" hastrue:true error:\"\"" {
+	if slr[0] != "master [true] name:\"a test\" id:\"test1\" status:pass hastrue:true error:\"\"" {
 		t.Fatalf("single line result master has incorrect format")
 	}
-	if slr[1] != "sub [true] name:\"a test\" id:\"test1\" identifier:\"test\"" {
+	if slr[1] != "sub [true] name:\"a test\" id:\"test1\" identifier:\"test\" value:\"value\" evaluator:\"regexp\" expression:\"value =~ ^va.*e$\"" {
 		t.Fatalf("single line result sub has incorrect format")
 	}
 
 	hrr_compare := `result for "a test" (test1)
 	master result: true
-	[true] identifier: "test"`
+	status: pass
+	[true] identifier: "test" value: "value" (regexp: value =~ ^va.*e$)`
 	if res.String() != hrr_compare {
 		t.Fatalf("human readable result has incorrect format")
 	}
 
-	json_compare := `{"testid":"test1","name":"a test","description":"","iserror":false,"error":"","masterresult":true,"hastrueresults":true,"results":[{"result":true,"identifier":"test"}]}`
+	json_compare := `{"testid":"test1","name":"a test","description":"","iserror":false,"error":"","status":"pass","masterresult":true,"hastrueresults":true,"results":[{"result":true,"identifier":"test","value":"value","evaluator":"regexp","expression":"value =~ ^va.*e$"}]}`
 	if res.JSON() != json_compare {
 		t.Fatalf("json result has incorrect format")
 	}
 }
+
+var engineIsolationDoc = `
+{
+	"objects": [
+	{
+		"object": "openssl-package",
+		"package": {
+			"name": "openssl"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "openssl-version",
+		"object": "openssl-package",
+		"evr": {
+			"operation": "<",
+			"value": "1.0.2"
+		}
+	}
+	]
+}
+`
+
+func TestEngineIsolation(t *testing.T) {
+	engines := []struct {
+		version string
+		result  bool
+	}{
+		{"1.0.1e", true},
+		{"1.0.2k", false},
+		{"1.0.1t", true},
+		{"1.1.0f", false},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(engines)*10)
+	for _, x := range engines {
+		ver := x.version
+		expect := x.result
+		e := scribe.NewEngine(scribe.WithPackageSources(
+			scribe.NewStaticPackageSource("fixture", []scribe.PackageInfo{
+				{Name: "openssl", Version: ver, Type: "test"},
+			})))
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				doc, err := e.LoadDocument(strings.NewReader(engineIsolationDoc))
+				if err != nil {
+					errs <- err
+					return
+				}
+				a, err := e.Analyze(context.Background(), doc)
+				if err != nil {
+					errs <- err
+					return
+				}
+				res, err := a.GetResults("openssl-version")
+				if err != nil {
+					errs <- err
+					return
+				}
+				if res.MasterResult != expect {
+					errs <- fmt.Errorf("engine with openssl %v returned %v", ver, res.MasterResult)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("%v", err)
+	}
+}
+
+var contextPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/filecontent" }
+	],
+
+	"objects": [
+	{
+		"object": "testfile0-test",
+		"filecontent": {
+			"path": "${root}",
+			"file": "testfile0",
+			"expression": ".*(Test).*"
+		}
+	},
+
+	{
+		"object": "raw",
+		"raw": {
+			"identifiers": [
+			{
+				"identifier": "test",
+				"value": "value"
+			}
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "filecontent",
+		"object": "testfile0-test"
+	},
+
+	{
+		"test": "raw",
+		"object": "raw"
+	}
+	]
+}
+`
+
+func TestAnalyzeContext(t *testing.T) {
+	e := scribe.NewEngine(scribe.WithTestHooks(true))
+	doc, err := e.LoadDocument(strings.NewReader(contextPolicyDoc))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = e.AnalyzeDocumentContext(ctx, doc)
+	if err != context.Canceled {
+		t.Fatalf("Engine.AnalyzeDocumentContext returned %v", err)
+	}
+	a, err := e.Analyze(ctx, doc)
+	if err != context.Canceled {
+		t.Fatalf("Engine.Analyze returned %v", err)
+	}
+	for _, x := range doc.GetTestIdentifiers() {
+		res, err := a.GetResults(x)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if !res.IsError || !res.IsTimeout {
+			t.Fatalf("test %v should have timed out", x)
+		}
+		if res.Error != scribe.ErrTimeout.Error() {
+			t.Fatalf("test %v has incorrect error %q", x, res.Error)
+		}
+	}
+}
+
+func TestObjectTimeout(t *testing.T) {
+	slowLocator := func(string, bool, string, scribe.LocatorOptions) ([]string, error) {
+		time.Sleep(100 * time.Millisecond)
+		return nil, nil
+	}
+	e := scribe.NewEngine(scribe.WithTestHooks(true), scribe.WithFileLocator(slowLocator),
+		scribe.WithObjectTimeout(10*time.Millisecond))
+	doc, err := e.LoadDocument(strings.NewReader(contextPolicyDoc))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	a, err := e.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Engine.Analyze: %v", err)
+	}
+	res, err := a.GetResults("filecontent")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if !res.IsTimeout {
+		t.Fatalf("filecontent test should have timed out")
+	}
+	res, err = a.GetResults("raw")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if res.IsError || !res.MasterResult {
+		t.Fatalf("raw test should not have been affected by timeout")
+	}
+}
+
+func analyzeAllResults(t *testing.T, e *scribe.Engine, documentStr string) []string {
+	doc, err := e.LoadDocument(strings.NewReader(documentStr))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	a, err := e.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Engine.Analyze: %v", err)
+	}
+	ret := make([]string, 0)
+	for _, x := range doc.GetTestIdentifiers() {
+		res, err := a.GetResults(x)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		ret = append(ret, res.JSON())
+	}
+	return ret
+}
+
+func TestParallelPreparation(t *testing.T) {
+	for _, x := range []string{fileContentPolicyDoc, fileNamePolicyDoc, importChainPolicyDoc, packagePolicyDoc} {
+		serial := analyzeAllResults(t, scribe.NewEngine(scribe.WithTestHooks(true),
+			scribe.WithParallelism(1)), x)
+		for i := 0; i < 10; i++ {
+			parallel := analyzeAllResults(t, scribe.NewEngine(scribe.WithTestHooks(true),
+				scribe.WithParallelism(8)), x)
+			if strings.Join(serial, "\n") != strings.Join(parallel, "\n") {
+				t.Fatalf("parallel results differ from serial results")
+			}
+		}
+	}
+}
+
+func TestDefaultSerialPreparation(t *testing.T) {
+	// Without WithParallelism, an installed locator should never be called
+	// concurrently.
+	var (
+		lock            sync.Mutex
+		active, maxSeen int
+	)
+	locator := func(string, bool, string, scribe.LocatorOptions) ([]string, error) {
+		lock.Lock()
+		active++
+		if active > maxSeen {
+			maxSeen = active
+		}
+		lock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		lock.Lock()
+		active--
+		lock.Unlock()
+		return nil, nil
+	}
+	analyzeAllResults(t, scribe.NewEngine(scribe.WithTestHooks(true),
+		scribe.WithFileLocator(locator)), fileContentPolicyDoc)
+	if maxSeen != 1 {
+		t.Fatalf("locator called concurrently by %v objects", maxSeen)
+	}
+}
+
+func TestParallelDebugOutput(t *testing.T) {
+	var buf bytes.Buffer
+	e := scribe.NewEngine(scribe.WithTestHooks(true), scribe.WithParallelism(4),
+		scribe.WithDebug(&buf))
+	analyzeAllResults(t, e, fileContentPolicyDoc)
+	if !strings.Contains(buf.String(), "[scribe] [testfile1-version] prepare(): analyzing file system") {
+		t.Fatalf("debug output not attributed to object")
+	}
+}
+
+var statusPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "openssl-package",
+		"package": {
+			"name": "openssl"
+		}
+	},
+
+	{
+		"object": "missing-package",
+		"package": {
+			"name": "notinstalled"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "pass",
+		"object": "openssl-package",
+		"evr": { "operation": "<", "value": "1.0.2" }
+	},
+
+	{
+		"test": "fail",
+		"object": "openssl-package",
+		"evr": { "operation": ">", "value": "1.0.2" }
+	},
+
+	{
+		"test": "notapplicable",
+		"object": "missing-package",
+		"evr": { "operation": "<", "value": "1.0.2" }
+	},
+
+	{
+		"test": "none-notinstalled",
+		"object": "missing-package",
+		"match": "none"
+	},
+
+	{
+		"test": "skipped",
+		"object": "openssl-package",
+		"if": [ "fail" ]
+	},
+
+	{
+		"test": "skipped-notapplicable",
+		"object": "openssl-package",
+		"if": [ "notapplicable" ]
+	},
+
+	{
+		"test": "error",
+		"object": "openssl-package",
+		"evr": { "operation": "badop", "value": "1.0.2" }
+	}
+	]
+}
+`
+
+func TestResultStatus(t *testing.T) {
+	e := scribe.NewEngine(scribe.WithTestHooks(true))
+	doc, err := e.LoadDocument(strings.NewReader(statusPolicyDoc))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	a, err := e.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Engine.Analyze: %v", err)
+	}
+	expect := map[string]scribe.TestStatus{
+		"pass":                  scribe.StatusPass,
+		"fail":                  scribe.StatusFail,
+		"notapplicable":         scribe.StatusNotApplicable,
+		"none-notinstalled":     scribe.StatusPass,
+		"skipped":               scribe.StatusSkipped,
+		"skipped-notapplicable": scribe.StatusSkipped,
+		"error":                 scribe.StatusError,
+	}
+	for k, v := range expect {
+		res, err := a.GetResults(k)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if res.Status != v {
+			t.Fatalf("test %v: expected status %v, got %v", k, v, res.Status)
+		}
+		if (v == scribe.StatusPass) != res.MasterResult {
+			t.Fatalf("test %v: master result %v inconsistent with status %v", k, res.MasterResult, v)
+		}
+	}
+}
+
+func TestAnalysisRerun(t *testing.T) {
+	doc, err := scribe.LoadDocument(strings.NewReader(engineIsolationDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+
+	// The same document analyzed concurrently by engines with different
+	// package sources should produce independent results, and leave the
+	// document unmodified.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		ver, expect := "1.0.1e", true
+		if i%2 == 0 {
+			ver, expect = "1.0.2k", false
+		}
+		e := scribe.NewEngine(scribe.WithPackageSources(
+			scribe.NewStaticPackageSource("fixture", []scribe.PackageInfo{
+				{Name: "openssl", Version: ver, Type: "test"},
+			})))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a, err := e.Analyze(context.Background(), doc)
+			if err != nil {
+				errs <- err
+				return
+			}
+			res, err := a.GetResults("openssl-version")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if res.MasterResult != expect || len(res.Results) != 1 {
+				errs <- fmt.Errorf("openssl %v: unexpected result %+v", ver, res)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("%v", err)
+	}
+
+	// Analyzing the same document repeatedly should produce the same
+	// results each time, rather than accumulating them.
+	e := scribe.NewEngine(scribe.WithTestHooks(true))
+	for i := 0; i < 3; i++ {
+		err := e.AnalyzeDocument(doc)
+		if err != nil {
+			t.Fatalf("Engine.AnalyzeDocument: %v", err)
+		}
+		a, err := e.Analyze(context.Background(), doc)
+		if err != nil {
+			t.Fatalf("Engine.Analyze: %v", err)
+		}
+		res, err := a.GetResults("openssl-version")
+		if err != nil {
+			t.Fatalf("Analysis.GetResults: %v", err)
+		}
+		if !res.MasterResult || len(res.Results) != 1 {
+			t.Fatalf("analysis %v: unexpected result %+v", i, res)
+		}
+	}
+	// The document itself was never analyzed, so asking it for results
+	// should fail rather than return empty results.
+	_, err = scribe.GetResults(&doc, "openssl-version")
+	if err == nil {
+		t.Fatalf("scribe.GetResults should fail for a document that was not analyzed")
+	}
+}
+
+// Used in TestAnalysisSummary
+var analysisSummaryDoc = `
+{
+	"objects": [
+	{
+		"object": "testfile0-version",
+		"filecontent": {
+			"path": "./test/filecontent",
+			"file": "testfile0",
+			"expression": "^(\\d)"
+		}
+	},
+
+	{
+		"object": "testfile0-test",
+		"filecontent": {
+			"path": "./test/filecontent",
+			"file": "testfile0",
+			"expression": "Test"
+		}
+	},
+
+	{
+		"object": "openssl-package",
+		"package": {
+			"name": "openssl"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "version",
+		"object": "testfile0-version"
+	},
+
+	{
+		"test": "test",
+		"object": "testfile0-test"
+	},
+
+	{
+		"test": "openssl",
+		"object": "openssl-package"
+	}
+	]
+}
+`
+
+func TestAnalysisSummary(t *testing.T) {
+	e := scribe.NewEngine(scribe.WithTestHooks(true), scribe.WithProfiling(true))
+	doc, err := e.LoadDocument(strings.NewReader(analysisSummaryDoc))
+	if err != nil {
+		t.Fatalf("Engine.LoadDocument: %v", err)
+	}
+	a, err := e.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Engine.Analyze: %v", err)
+	}
+	s := a.Summary()
+	if s.Duration <= 0 || s.Preparation <= 0 || s.Evaluation <= 0 {
+		t.Fatalf("unexpected summary durations %+v", s)
+	}
+	if len(s.Objects) != 3 || len(s.Tests) != 3 {
+		t.Fatalf("expected 3 objects and 3 tests, got %+v", s)
+	}
+	// Both file objects search the same tree, so it should only be
+	// walked once and the file read once.
+	if s.Walks != 1 || s.FilesRead != 1 || s.FileCacheHits != 1 {
+		t.Fatalf("unexpected file index counters %+v", s)
+	}
+	for _, x := range s.Objects {
+		if x.Prepare <= 0 {
+			t.Fatalf("object %v: no preparation time recorded", x.Object)
+		}
+		if x.Object != "openssl-package" && (x.FilesWalked == 0 || x.FilesRead != 1) {
+			t.Fatalf("object %v: unexpected file counters %+v", x.Object, x)
+		}
+	}
+
+	res, err := a.GetResults("test")
+	if err != nil {
+		t.Fatalf("Analysis.GetResults: %v", err)
+	}
+	if res.Timing == nil || res.Timing.TestID != "test" ||
+		res.Timing.Object.Object != "testfile0-test" || res.Timing.Evaluation <= 0 {
+		t.Fatalf("unexpected test timing %+v", res.Timing)
+	}
+
+	// Without profiling, results do not include timing, so they are the
+	// same each time a document is analyzed.
+	e = scribe.NewEngine(scribe.WithTestHooks(true))
+	a, err = e.Analyze(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Engine.Analyze: %v", err)
+	}
+	res, err = a.GetResults("test")
+	if err != nil {
+		t.Fatalf("Analysis.GetResults: %v", err)
+	}
+	if res.Timing != nil {
+		t.Fatalf("timing included without profiling")
+	}
+}
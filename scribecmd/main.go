@@ -7,10 +7,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/mozilla/scribe"
 	"os"
+	"sort"
 )
 
 var flagDebug bool
@@ -29,6 +31,8 @@ func main() {
 		lineFmt      bool
 		jsonFmt      bool
 		onlyTrue     bool
+		warnErrors   bool
+		profile      bool
 	)
 
 	err := scribe.Bootstrap()
@@ -43,8 +47,10 @@ func main() {
 	flag.BoolVar(&lineFmt, "l", false, "output one result per line")
 	flag.BoolVar(&jsonFmt, "j", false, "JSON output mode")
 	flag.BoolVar(&testHooks, "t", false, "enable test hooks")
+	flag.BoolVar(&profile, "p", false, "print analysis timing to stderr sorted by cost, and include timing in results")
 	flag.BoolVar(&onlyTrue, "T", false, "only show true outcomes in results")
 	flag.BoolVar(&showVersion, "v", false, "show version")
+	flag.BoolVar(&warnErrors, "w", false, "treat object preparation warnings as test errors")
 	flag.Parse()
 
 	if showVersion {
@@ -62,6 +68,7 @@ func main() {
 	}
 
 	scribe.TestHooks(testHooks)
+	scribe.SetProfiling(profile)
 
 	fd, err := os.Open(docpath)
 	if err != nil {
@@ -74,6 +81,9 @@ func main() {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	if warnErrors {
+		doc.Options.WarningsAsErrors = true
+	}
 
 	// In expectedExit mode, set a callback in the scribe module that will
 	// be called immediately during analysis if a test result does not
@@ -83,14 +93,14 @@ func main() {
 		scribe.ExpectedCallback(failExit)
 	}
 
-	err = scribe.AnalyzeDocument(doc)
+	analysis, err := scribe.Analyze(context.Background(), doc)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 
-	for _, x := range doc.GetTestIdentifiers() {
-		tr, err := scribe.GetResults(&doc, x)
+	for _, x := range analysis.GetTestIdentifiers() {
+		tr, err := analysis.GetResults(x)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error obtaining results for \"%v\": %v\n", x, err)
 			continue
@@ -111,5 +121,42 @@ func main() {
 		}
 	}
 
+	if profile {
+		printProfile(analysis.Summary())
+	}
+
 	os.Exit(0)
 }
+
+// objectsByPrepare sorts object timings by preparation time, longest first.
+type objectsByPrepare []scribe.ObjectTiming
+
+func (o objectsByPrepare) Len() int           { return len(o) }
+func (o objectsByPrepare) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o objectsByPrepare) Less(i, j int) bool { return o[i].Prepare > o[j].Prepare }
+
+// testsByEvaluation sorts test timings by evaluation time, longest first.
+type testsByEvaluation []scribe.TestTiming
+
+func (t testsByEvaluation) Len() int           { return len(t) }
+func (t testsByEvaluation) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t testsByEvaluation) Less(i, j int) bool { return t[i].Evaluation > t[j].Evaluation }
+
+// printProfile writes the timing summary for an analysis to stderr, with the
+// most expensive objects and tests first.
+func printProfile(s scribe.AnalysisSummary) {
+	fmt.Fprintf(os.Stderr, "profile: total %v, preparation %v, evaluation %v, package cache %v\n",
+		s.Duration, s.Preparation, s.Evaluation, s.PackageCache)
+	fmt.Fprintf(os.Stderr, "profile: %v walks, %v files walked, %v files read, %v file cache hits\n",
+		s.Walks, s.FilesWalked, s.FilesRead, s.FileCacheHits)
+	sort.Stable(objectsByPrepare(s.Objects))
+	for _, x := range s.Objects {
+		fmt.Fprintf(os.Stderr, "profile: object \"%v\" prepare %v, package cache %v, %v files walked, %v files read\n",
+			x.Object, x.Prepare, x.PackageCache, x.FilesWalked, x.FilesRead)
+	}
+	sort.Stable(testsByEvaluation(s.Tests))
+	for _, x := range s.Tests {
+		fmt.Fprintf(os.Stderr, "profile: test \"%v\" evaluation %v, object \"%v\"\n",
+			x.TestID, x.Evaluation, x.Object.Object)
+	}
+}
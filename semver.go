@@ -0,0 +1,392 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a version parsed according to the Semantic Versioning 2.0.0
+// specification (https://semver.org). A leading "v" is permitted.
+type semver struct {
+	major uint64
+	minor uint64
+	patch uint64
+	pre   []string // Pre-release identifiers, if any.
+	build string   // Build metadata, ignored for precedence.
+}
+
+func semverNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func semverValidIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') ||
+			(c >= 'A' && c <= 'Z') || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func parseSemver(s string) (ret semver, err error) {
+	v := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if idx := strings.Index(v, "+"); idx != -1 {
+		ret.build = v[idx+1:]
+		v = v[:idx]
+		for _, x := range strings.Split(ret.build, ".") {
+			if !semverValidIdentifier(x) {
+				return ret, fmt.Errorf("invalid semver \"%v\": bad build metadata", s)
+			}
+		}
+	}
+	if idx := strings.Index(v, "-"); idx != -1 {
+		ret.pre = strings.Split(v[idx+1:], ".")
+		v = v[:idx]
+		for _, x := range ret.pre {
+			if !semverValidIdentifier(x) {
+				return ret, fmt.Errorf("invalid semver \"%v\": bad pre-release", s)
+			}
+			if semverNumeric(x) && len(x) > 1 && x[0] == '0' {
+				return ret, fmt.Errorf("invalid semver \"%v\": leading zero in pre-release", s)
+			}
+		}
+	}
+	core := strings.Split(v, ".")
+	if len(core) != 3 {
+		return ret, fmt.Errorf("invalid semver \"%v\": must have major, minor and patch", s)
+	}
+	var nums [3]uint64
+	for i, x := range core {
+		if !semverNumeric(x) || (len(x) > 1 && x[0] == '0') {
+			return ret, fmt.Errorf("invalid semver \"%v\": bad version component \"%v\"", s, x)
+		}
+		nums[i], err = strconv.ParseUint(x, 10, 64)
+		if err != nil {
+			return ret, fmt.Errorf("invalid semver \"%v\": %v", s, err)
+		}
+	}
+	ret.major, ret.minor, ret.patch = nums[0], nums[1], nums[2]
+	return ret, nil
+}
+
+func semverCmpUint(a uint64, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// compare returns -1 if s has lower precedence than o, 1 if it has higher
+// precedence, and 0 if they have equal precedence.
+func (s semver) compare(o semver) int {
+	if r := semverCmpUint(s.major, o.major); r != 0 {
+		return r
+	}
+	if r := semverCmpUint(s.minor, o.minor); r != 0 {
+		return r
+	}
+	if r := semverCmpUint(s.patch, o.patch); r != 0 {
+		return r
+	}
+	// A version without a pre-release has higher precedence than the
+	// same version with one.
+	if len(s.pre) == 0 || len(o.pre) == 0 {
+		if len(s.pre) == len(o.pre) {
+			return 0
+		} else if len(s.pre) == 0 {
+			return 1
+		}
+		return -1
+	}
+	for i := 0; i < len(s.pre) && i < len(o.pre); i++ {
+		a, b := s.pre[i], o.pre[i]
+		an, bn := semverNumeric(a), semverNumeric(b)
+		switch {
+		case an && bn:
+			na, _ := strconv.ParseUint(a, 10, 64)
+			nb, _ := strconv.ParseUint(b, 10, 64)
+			if r := semverCmpUint(na, nb); r != 0 {
+				return r
+			}
+		case an:
+			// Numeric identifiers have lower precedence.
+			return -1
+		case bn:
+			return 1
+		default:
+			if a < b {
+				return -1
+			} else if a > b {
+				return 1
+			}
+		}
+	}
+	return semverCmpUint(uint64(len(s.pre)), uint64(len(o.pre)))
+}
+
+// semverCompare compares two semantic version strings. The return value
+// follows the convention used by evrRpmCompare; 1 if check is newer than
+// actual, -1 if actual is newer than check, and 0 if they are equal.
+func semverCompare(actual string, check string) (int, error) {
+	sa, err := parseSemver(actual)
+	if err != nil {
+		return 0, err
+	}
+	sc, err := parseSemver(check)
+	if err != nil {
+		return 0, err
+	}
+	return sc.compare(sa), nil
+}
+
+// SemverTest describes a semantic version comparison that will be performed
+// as part of a test. Values returned by the object must be valid semantic
+// versions (see https://semver.org), optionally prefixed with "v", or the test
+// will result in an error.
+//
+// Either Operation and Value can be set, in which case the version is compared
+// against Value using one of "<", "<=", ">", ">=", "=" or "!=", or Constraint
+// can be set to a constraint expression. A constraint is a space separated
+// list of comparisons which must all be satisfied, for example
+// ">=1.2.0 <1.5.0". Multiple lists can be joined with "||", in which case any
+// of them can be satisfied. A comparison can also use the caret and tilde
+// forms:
+//
+//	^1.2.3 is >=1.2.3 <2.0.0, ^0.2.3 is >=0.2.3 <0.3.0, ^0.0.3 is >=0.0.3 <0.0.4
+//	~1.2.3 is >=1.2.3 <1.3.0, ~1.2 is >=1.2.0 <1.3.0, ~1 is >=1.0.0 <2.0.0
+//
+// When a constraint is used, a version with a pre-release (such as
+// 1.3.0-rc.1) only satisfies a list of comparisons if one of the comparisons
+// is against a pre-release of the same major, minor and patch version. This
+// prevents constraints such as ^1.2.0 from matching unstable releases.
+// Build metadata is ignored in all comparisons.
+type SemverTest struct {
+	Operation  string `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Value      string `json:"value,omitempty" yaml:"value,omitempty"`
+	Constraint string `json:"constraint,omitempty" yaml:"constraint,omitempty"`
+}
+
+type semverComparator struct {
+	op int
+	v  semver
+}
+
+// semverConstraint is a list of comparison lists; the constraint is satisfied
+// if all comparisons in any one list are satisfied.
+type semverConstraint [][]semverComparator
+
+func (s *SemverTest) isSet() bool {
+	return s.Value != "" || s.Constraint != ""
+}
+
+func (s *SemverTest) validate() error {
+	if s.Constraint != "" {
+		if s.Value != "" || s.Operation != "" {
+			return fmt.Errorf("semver constraint cannot be combined with operation and value")
+		}
+		_, err := parseSemverConstraint(s.Constraint)
+		return err
+	}
+	if evrLookupOperation(s.Operation) == EvropUnknown {
+		return fmt.Errorf("invalid semver operation %v", s.Operation)
+	}
+	_, err := parseSemver(s.Value)
+	return err
+}
+
+func (s *SemverTest) evaluate(d *Document, c evaluationCriteria) (ret evaluationResult, err error) {
+	ret.criteria = c
+	ret.evaluator = "semver"
+	v, err := parseSemver(c.testValue)
+	if err != nil {
+		return ret, err
+	}
+	if s.Constraint != "" {
+		d.debugPrint("evaluate(): semver %v \"%v\", constraint \"%v\"\n", c.identifier, c.testValue, s.Constraint)
+		ret.expression = fmt.Sprintf("%v satisfies %v", c.testValue, s.Constraint)
+		cons, err := parseSemverConstraint(s.Constraint)
+		if err != nil {
+			return ret, err
+		}
+		ret.result = cons.satisfiedBy(v)
+		return ret, nil
+	}
+	d.debugPrint("evaluate(): semver %v \"%v\", %v \"%v\"\n", c.identifier, c.testValue, s.Operation, s.Value)
+	ret.expression = fmt.Sprintf("%v %v %v", c.testValue, s.Operation, s.Value)
+	op := evrLookupOperation(s.Operation)
+	if op == EvropUnknown {
+		return ret, fmt.Errorf("invalid semver operation %v", s.Operation)
+	}
+	check, err := parseSemver(s.Value)
+	if err != nil {
+		return ret, err
+	}
+	ret.result = semverComparator{op: op, v: check}.satisfiedBy(v)
+	return ret, nil
+}
+
+func (c semverComparator) satisfiedBy(v semver) bool {
+	r := v.compare(c.v)
+	switch c.op {
+	case EvropLessThan:
+		return r < 0
+	case EvropLessThanOrEqual:
+		return r <= 0
+	case EvropGreaterThan:
+		return r > 0
+	case EvropGreaterThanOrEqual:
+		return r >= 0
+	case EvropEquals:
+		return r == 0
+	case EvropNotEquals:
+		return r != 0
+	}
+	return false
+}
+
+func (c semverConstraint) satisfiedBy(v semver) bool {
+	for _, x := range c {
+		if semverAllSatisfied(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func semverAllSatisfied(cl []semverComparator, v semver) bool {
+	for _, x := range cl {
+		if !x.satisfiedBy(v) {
+			return false
+		}
+	}
+	if len(v.pre) == 0 {
+		return true
+	}
+	// Pre-release versions are only included if a comparison in the list
+	// explicitly refers to a pre-release of the same version.
+	for _, x := range cl {
+		if len(x.v.pre) > 0 && x.v.major == v.major &&
+			x.v.minor == v.minor && x.v.patch == v.patch {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSemverConstraint(s string) (ret semverConstraint, err error) {
+	for _, x := range strings.Split(s, "||") {
+		cl := make([]semverComparator, 0)
+		tokens := strings.Fields(x)
+		for i := 0; i < len(tokens); i++ {
+			tok := tokens[i]
+			// Allow whitespace between an operator and the version.
+			if strings.Trim(tok, "<>=!^~") == "" && i+1 < len(tokens) {
+				i++
+				tok += tokens[i]
+			}
+			c, err := parseSemverComparison(tok)
+			if err != nil {
+				return nil, fmt.Errorf("invalid semver constraint \"%v\": %v", s, err)
+			}
+			cl = append(cl, c...)
+		}
+		if len(cl) == 0 {
+			return nil, fmt.Errorf("invalid semver constraint \"%v\": empty comparison list", s)
+		}
+		ret = append(ret, cl)
+	}
+	return ret, nil
+}
+
+// parseSemverComparison parses a single comparison in a constraint, returning
+// the comparators it is equivalent to.
+func parseSemverComparison(s string) ([]semverComparator, error) {
+	for _, x := range []string{"<=", ">=", "!=", "<", ">", "="} {
+		if !strings.HasPrefix(s, x) {
+			continue
+		}
+		v, err := parseSemver(s[len(x):])
+		if err != nil {
+			return nil, err
+		}
+		return []semverComparator{{op: evrLookupOperation(x), v: v}}, nil
+	}
+	if strings.HasPrefix(s, "^") || strings.HasPrefix(s, "~") {
+		lower, n, err := parsePartialSemver(s[1:])
+		if err != nil {
+			return nil, err
+		}
+		upper := semver{}
+		if s[0] == '^' {
+			// Allow changes that do not modify the left-most non-zero
+			// component.
+			switch {
+			case lower.major > 0 || n == 1:
+				upper.major = lower.major + 1
+			case lower.minor > 0 || n == 2:
+				upper.minor = lower.minor + 1
+			default:
+				upper.patch = lower.patch + 1
+			}
+		} else {
+			// Allow patch level changes if a minor version is given,
+			// otherwise minor level changes.
+			upper.major = lower.major + 1
+			if n > 1 {
+				upper.major = lower.major
+				upper.minor = lower.minor + 1
+			}
+		}
+		return []semverComparator{
+			{op: EvropGreaterThanOrEqual, v: lower},
+			{op: EvropLessThan, v: upper},
+		}, nil
+	}
+	v, err := parseSemver(s)
+	if err != nil {
+		return nil, err
+	}
+	return []semverComparator{{op: EvropEquals, v: v}}, nil
+}
+
+// parsePartialSemver parses a version that may omit the minor and patch
+// components, as permitted in caret and tilde comparisons. The number of
+// components present is also returned.
+func parsePartialSemver(s string) (semver, int, error) {
+	core := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(core) >= 3 {
+		v, err := parseSemver(s)
+		return v, 3, err
+	}
+	for len(core) < 3 {
+		core = append(core, "0")
+	}
+	v, err := parseSemver(strings.Join(core, "."))
+	if err != nil {
+		return v, 0, fmt.Errorf("invalid semver \"%v\"", s)
+	}
+	return v, len(strings.Split(strings.TrimPrefix(s, "v"), ".")), nil
+}
@@ -0,0 +1,351 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Sysctl is used to perform tests against kernel parameters, as read from
+// /proc/sys or configured in the sysctl configuration files.
+//
+// Either Key or Expression must be set. Key is the name of a single parameter
+// in dotted form, for example net.ipv4.ip_forward. Expression is a regular
+// expression matched against the dotted name of every parameter, for example
+// "^net\.ipv4\.conf\..*\.rp_filter$".
+//
+// Source controls where values are read from. If unset or runtime, the live
+// value of each parameter is read from /proc/sys, and the candidate identifier
+// is the parameter name. If persisted, the value that will be applied at boot
+// is read from the sysctl configuration files, and the candidate identifier is
+// the file that sets the value followed by a colon and the parameter name. If
+// all, candidates for both are returned. Parameters that do not exist, or are
+// not persisted, produce no candidates.
+//
+// The configuration files are read in the same way as sysctl --system. The
+// *.conf files in /etc/sysctl.d, /run/sysctl.d, /usr/local/lib/sysctl.d,
+// /usr/lib/sysctl.d and /lib/sysctl.d are read in order of their file names,
+// where a file in a directory earlier in that list replaces a file with the
+// same name in a later one, followed by /etc/sysctl.conf. The last value set
+// for a parameter is used.
+//
+// Values are returned with runs of whitespace replaced by a single space, so
+// parameters with multiple values can be compared regardless of how they are
+// formatted.
+//
+// Root can be set to read /proc/sys and /etc relative to a directory other
+// than /.
+type Sysctl struct {
+	Key        string `json:"key,omitempty" yaml:"key,omitempty"`
+	Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
+	Source     string `json:"source,omitempty" yaml:"source,omitempty"`
+	Root       string `json:"root,omitempty" yaml:"root,omitempty"`
+
+	matches []sysctlMatch
+}
+
+type sysctlMatch struct {
+	identifier string
+	value      string
+	line       int // The line number for persisted values.
+}
+
+func (s *Sysctl) isChain() bool {
+	return false
+}
+
+func (s *Sysctl) fireChains(ctx context.Context, d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (s *Sysctl) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (s *Sysctl) validate(d *Document) error {
+	if s.Key == "" && s.Expression == "" {
+		return fmt.Errorf("sysctl key or expression must be set")
+	}
+	if s.Key != "" && s.Expression != "" {
+		return fmt.Errorf("sysctl key and expression cannot both be set")
+	}
+	if s.Expression != "" {
+		_, err := regexp.Compile(s.Expression)
+		if err != nil {
+			return err
+		}
+	}
+	switch s.Source {
+	case "", "runtime", "persisted", "all":
+	default:
+		return fmt.Errorf("sysctl source %v is not valid", s.Source)
+	}
+	return nil
+}
+
+func (s *Sysctl) expandVariables(d *Document, v []Variable) {
+	s.Root = variableExpansion(d, v, s.Root)
+}
+
+func (s *Sysctl) getCriteria(d *Document) (ret []evaluationCriteria) {
+	for _, x := range s.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		n.line = x.line
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (s *Sysctl) root() string {
+	if s.Root == "" {
+		return "/"
+	}
+	return s.Root
+}
+
+// matchKey returns true if the parameter key is selected by the object.
+func (s *Sysctl) matchKey(re *regexp.Regexp, key string) bool {
+	if re != nil {
+		return re.MatchString(key)
+	}
+	return key == s.Key
+}
+
+func (s *Sysctl) prepare(ctx context.Context, d *Document) error {
+	var (
+		re  *regexp.Regexp
+		err error
+	)
+	if s.Expression != "" {
+		re, err = regexp.Compile(s.Expression)
+		if err != nil {
+			return err
+		}
+	}
+	if s.Source == "" || s.Source == "runtime" || s.Source == "all" {
+		err = s.prepareRuntime(ctx, d, re)
+		if err != nil {
+			return err
+		}
+	}
+	if s.Source == "persisted" || s.Source == "all" {
+		err = s.preparePersisted(ctx, d, re)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareRuntime reads the live values of the selected parameters.
+func (s *Sysctl) prepareRuntime(ctx context.Context, d *Document, re *regexp.Regexp) error {
+	procsys := filepath.Join(s.root(), "proc", "sys")
+	d.debugPrint("prepare(): reading kernel parameters from %v\n", procsys)
+
+	if re == nil {
+		// A single key can be read directly.
+		path := filepath.Join(procsys, sysctlKeyToPath(s.Key))
+		v, err := s.readValue(d, path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				d.warn(path, err)
+			}
+			return nil
+		}
+		s.matches = append(s.matches, sysctlMatch{identifier: s.Key, value: v})
+		return nil
+	}
+
+	return filepath.Walk(procsys, func(path string, fi os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if !os.IsNotExist(err) {
+				d.warn(path, err)
+			}
+			if fi != nil && fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Some parameters are write only, such as
+		// vm.drop_caches, and are not considered.
+		if !fi.Mode().IsRegular() || fi.Mode().Perm()&0444 == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(procsys, path)
+		if err != nil {
+			return err
+		}
+		key := sysctlPathToKey(rel)
+		if !re.MatchString(key) {
+			return nil
+		}
+		v, err := s.readValue(d, path)
+		if err != nil {
+			// Reading some parameters fails with EIO if they have not
+			// been set, such as the IPv6 stable_secret; these are
+			// ignored rather than warned about.
+			if pe, ok := err.(*os.PathError); !ok || pe.Err != syscall.EIO {
+				d.warn(path, err)
+			}
+			return nil
+		}
+		s.matches = append(s.matches, sysctlMatch{identifier: key, value: v})
+		return nil
+	})
+}
+
+func (s *Sysctl) readValue(d *Document, path string) (string, error) {
+	if d.object != nil {
+		d.object.stats.filesRead++
+	}
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(buf)), " "), nil
+}
+
+// The directories containing sysctl configuration files, relative to the root
+// and in order of precedence.
+var sysctlConfigDirs = []string{"etc/sysctl.d", "run/sysctl.d", "usr/local/lib/sysctl.d",
+	"usr/lib/sysctl.d", "lib/sysctl.d"}
+
+// persistedFiles returns the sysctl configuration files in the order they are
+// applied.
+func (s *Sysctl) persistedFiles() ([]string, error) {
+	byname := make(map[string]string)
+	names := make([]string, 0)
+	for _, x := range sysctlConfigDirs {
+		files, err := filepath.Glob(filepath.Join(s.root(), filepath.FromSlash(x), "*.conf"))
+		if err != nil {
+			return nil, err
+		}
+		for _, y := range files {
+			name := filepath.Base(y)
+			if _, ok := byname[name]; ok {
+				continue
+			}
+			byname[name] = y
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	ret := make([]string, 0, len(names)+1)
+	for _, x := range names {
+		ret = append(ret, byname[x])
+	}
+	return append(ret, filepath.Join(s.root(), "etc", "sysctl.conf")), nil
+}
+
+// preparePersisted reads the values of the selected parameters from the
+// sysctl configuration files, keeping the last value set for each parameter.
+func (s *Sysctl) preparePersisted(ctx context.Context, d *Document, re *regexp.Regexp) error {
+	files, err := s.persistedFiles()
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]sysctlMatch)
+	keys := make([]string, 0)
+	for _, x := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		d.debugPrint("prepare(): reading kernel parameters from %v\n", x)
+		if d.object != nil {
+			d.object.stats.filesRead++
+		}
+		lineno := 0
+		err := d.fsIndex.scanLines(ctx, x, func(ln string) {
+			lineno++
+			key, value, ok := sysctlParseLine(ln)
+			if !ok || !s.matchKey(re, key) {
+				return
+			}
+			if _, ok := found[key]; !ok {
+				keys = append(keys, key)
+			}
+			found[key] = sysctlMatch{identifier: x + ":" + key, value: value, line: lineno}
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !os.IsNotExist(err) {
+				d.warn(x, err)
+			}
+		}
+	}
+	sort.Strings(keys)
+	for _, x := range keys {
+		s.matches = append(s.matches, found[x])
+	}
+	return nil
+}
+
+// sysctlParseLine parses a line from a sysctl configuration file, returning
+// the key in dotted form and the value. The last return value is false if the
+// line does not set a parameter.
+func sysctlParseLine(ln string) (string, string, bool) {
+	ln = strings.TrimSpace(ln)
+	if ln == "" || ln[0] == '#' || ln[0] == ';' {
+		return "", "", false
+	}
+	// A leading - indicates errors setting the parameter are ignored.
+	ln = strings.TrimPrefix(ln, "-")
+	idx := strings.Index(ln, "=")
+	if idx == -1 {
+		return "", "", false
+	}
+	key := strings.TrimSpace(ln[:idx])
+	if key == "" {
+		return "", "", false
+	}
+	// Keys can also be written with / separators, in which case any dots
+	// are part of a name.
+	if i := strings.IndexAny(key, "./"); i != -1 && key[i] == '/' {
+		key = sysctlPathToKey(key)
+	}
+	value := strings.Join(strings.Fields(ln[idx+1:]), " ")
+	return key, value, true
+}
+
+// sysctlKeyToPath converts a dotted parameter name into a path relative to
+// /proc/sys. Since dots separate the components of the name, a dot in a file
+// name (such as a VLAN interface name) is written as / in the parameter name.
+func sysctlKeyToPath(key string) string {
+	return filepath.FromSlash(strings.Map(sysctlSwapSeparator, key))
+}
+
+// sysctlPathToKey converts a path relative to /proc/sys into a dotted
+// parameter name.
+func sysctlPathToKey(path string) string {
+	return strings.Map(sysctlSwapSeparator, filepath.ToSlash(path))
+}
+
+func sysctlSwapSeparator(r rune) rune {
+	switch r {
+	case '.':
+		return '/'
+	case '/':
+		return '.'
+	}
+	return r
+}
@@ -0,0 +1,226 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestSysctlPolicy
+var sysctlPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/sysctl" }
+	],
+
+	"objects": [
+	{
+		"object": "ip-forward",
+		"sysctl": {
+			"key": "net.ipv4.ip_forward",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "ip-forward-persisted",
+		"sysctl": {
+			"key": "net.ipv4.ip_forward",
+			"source": "persisted",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "ip-forward-all",
+		"sysctl": {
+			"key": "net.ipv4.ip_forward",
+			"source": "all",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "rp-filter",
+		"sysctl": {
+			"expression": "^net\\.ipv4\\.conf\\..*\\.rp_filter$",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "rp-filter-persisted",
+		"sysctl": {
+			"expression": "^net\\.ipv4\\.conf\\..*\\.rp_filter$",
+			"source": "persisted",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "tcp-rmem",
+		"sysctl": {
+			"key": "net.ipv4.tcp_rmem",
+			"source": "all",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "aslr-persisted",
+		"sysctl": {
+			"key": "kernel.randomize_va_space",
+			"source": "persisted",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "kernel-persisted",
+		"sysctl": {
+			"expression": "^kernel\\.",
+			"source": "persisted",
+			"root": "${root}"
+		}
+	},
+
+	{
+		"object": "nonexistent",
+		"sysctl": {
+			"key": "net.ipv4.nonexistent",
+			"source": "all",
+			"root": "${root}"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "sysctl0",
+		"expectedresult": true,
+		"object": "ip-forward",
+		"exactmatch": { "value": "1" }
+	},
+
+	{
+		"test": "sysctl1",
+		"expectedresult": true,
+		"object": "ip-forward-persisted",
+		"exactmatch": { "value": "0" }
+	},
+
+	{
+		"test": "sysctl2",
+		"expectedresult": false,
+		"object": "ip-forward-all",
+		"match": "all",
+		"exactmatch": { "value": "1" }
+	},
+
+	{
+		"test": "sysctl3",
+		"expectedresult": false,
+		"object": "rp-filter",
+		"match": "all",
+		"exactmatch": { "value": "1" }
+	},
+
+	{
+		"test": "sysctl4",
+		"expectedresult": true,
+		"object": "rp-filter-persisted",
+		"match": "all",
+		"exactmatch": { "value": "1" }
+	},
+
+	{
+		"test": "sysctl5",
+		"expectedresult": true,
+		"object": "tcp-rmem",
+		"match": "count",
+		"mincount": 2,
+		"exactmatch": { "value": "4096 87380 6291456" }
+	},
+
+	{
+		"test": "sysctl6",
+		"expectedresult": true,
+		"object": "aslr-persisted",
+		"match": "all",
+		"numeric": { "operation": "=", "value": "2" }
+	},
+
+	{
+		"test": "sysctl7",
+		"expectedresult": false,
+		"object": "nonexistent"
+	},
+
+	{
+		"test": "sysctl8",
+		"expectedresult": true,
+		"object": "kernel-persisted",
+		"match": "all",
+		"numeric": { "operation": ">=", "value": "1" }
+	}
+	]
+}
+`
+
+func TestSysctlPolicy(t *testing.T) {
+	a := genericTestExec(t, sysctlPolicyDoc)
+
+	expect := map[string][]string{
+		"sysctl1": {"test/sysctl/etc/sysctl.conf:net.ipv4.ip_forward"},
+		"sysctl3": {"net.ipv4.conf.all.rp_filter", "net.ipv4.conf.eth0/100.rp_filter"},
+		"sysctl4": {
+			"test/sysctl/etc/sysctl.d/10-network.conf:net.ipv4.conf.all.rp_filter",
+			"test/sysctl/etc/sysctl.d/10-network.conf:net.ipv4.conf.eth0/100.rp_filter",
+		},
+		// Files are applied in order of their names, and a file in
+		// /etc/sysctl.d replaces one with the same name in /usr/lib,
+		// which in turn replaces one in /lib.
+		"sysctl8": {
+			"test/sysctl/run/sysctl.d/60-runtime.conf:kernel.dmesg_restrict",
+			"test/sysctl/usr/lib/sysctl.d/50-default.conf:kernel.kptr_restrict",
+			"test/sysctl/etc/sysctl.d/99-kernel.conf:kernel.randomize_va_space",
+		},
+	}
+	for k, v := range expect {
+		res, err := a.GetResults(k)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if len(res.Results) != len(v) {
+			t.Fatalf("%v: unexpected results %+v", k, res.Results)
+		}
+		for i := range v {
+			if res.Results[i].Identifier != v[i] {
+				t.Fatalf("%v: expected identifier %v, got %v", k, v[i], res.Results[i].Identifier)
+			}
+		}
+	}
+}
+
+func TestSysctlValidation(t *testing.T) {
+	for _, x := range []string{
+		"key: a.b\n      expression: a",
+		"expression: \"(\"",
+		"key: a.b\n      source: boot",
+		"root: /",
+	} {
+		docstr := "objects:\n  - object: obj\n    sysctl:\n      " + x + "\n"
+		_, err := scribe.LoadDocument(strings.NewReader(docstr))
+		if err == nil {
+			t.Fatalf("document with %q should not validate", x)
+		}
+	}
+}
@@ -10,6 +10,7 @@ package scribe
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // TestTag describes arbitrary key value tags that can be associated with a test
@@ -27,14 +28,21 @@ type Test struct {
 	Object      string `json:"object" yaml:"object"` // The object this test references.
 	Description string `json:"description,omitempty" yaml:"description,omitempty"`
 
-	// Evaluators
-	EVR    EVRTest    `json:"evr,omitempty" yaml:"evr,omitempty"`               // EVR version comparison
-	Regexp Regex      `json:"regexp,omitempty" yaml:"regexp,omitempty"`         // Regular expression comparison
-	EMatch ExactMatch `json:"exactmatch,omitempty" yaml:"exactmatch,omitempty"` // Exact string match
+	// The criteria to evaluate; see Evaluator.
+	Evaluator `yaml:",inline"`
 
 	Tags []TestTag `json:"tags,omitempty" yaml:"tags,omitempty"` // Tags associated with the test
 
-	If []string `json:"if,omitempty" yaml:"if,omitempty"` // Slice of test names for dependencies
+	If      []string    `json:"if,omitempty" yaml:"if,omitempty"`           // Slice of test names for dependencies
+	Depends *Dependency `json:"depends,omitempty" yaml:"depends,omitempty"` // Dependency expression, see Dependency
+
+	// Match controls how the results for each candidate returned by the
+	// object are rolled up into the master result for the test; see
+	// the Match constants. If not set, MatchAny is used. MinCount and
+	// MaxCount are used with MatchCount.
+	Match    string `json:"match,omitempty" yaml:"match,omitempty"`
+	MinCount int    `json:"mincount,omitempty" yaml:"mincount,omitempty"`
+	MaxCount int    `json:"maxcount,omitempty" yaml:"maxcount,omitempty"`
 
 	// These values are optional but can be set to use the expected result
 	// callback handler. These are primarily used for testing but can also
@@ -49,20 +57,61 @@ type Test struct {
 	err error // The last error condition encountered during preparation or execution.
 
 	// The final result for this test, a rolled up version of the results
-	// of this test for any identified candidates. If at least one
+	// of this test for any identified candidates. How the results are
+	// rolled up is controlled by Match; by default if at least one
 	// candidate for the test evaluated to true, the master result will be
 	// true.
 	masterResult   bool               // The final result for the test.
 	hasTrueResults bool               // True if at least one result evaluated to true.
 	results        []evaluationResult // A slice of results for the test.
+	status         TestStatus         // The outcome of the test.
+	evalTime       time.Duration      // Time spent evaluating the test, excluding dependencies.
 }
 
+// Match modes for a test, which control how the results for each candidate
+// are rolled up into the master result.
+//
+// With MatchAny the master result is true if at least one candidate evaluated
+// to true. With MatchAll it is true if every candidate evaluated to true, and
+// with MatchNone it is true if no candidate evaluated to true. With MatchCount
+// it is true if the number of candidates that evaluated to true is at least
+// MinCount, and at most MaxCount if MaxCount is greater than 0.
+//
+// If the object returned no candidates, the master result is false for
+// MatchAny and MatchAll, true for MatchNone, and for MatchCount is true only
+// if MinCount is 0.
+const (
+	MatchAny   = "any"
+	MatchAll   = "all"
+	MatchNone  = "none"
+	MatchCount = "count"
+)
+
+// TestStatus describes the outcome of a test.
+type TestStatus string
+
+// Test status values. A test that evaluated has a status of StatusPass if the
+// master result is true, or StatusFail if it is false. If the object the test
+// references returned no candidates (for example a package that is not
+// installed), the status is StatusNotApplicable, unless the match mode for the
+// test resulted in true. If a dependency of the test was false, the status is
+// StatusSkipped. StatusError indicates an error occurred.
+const (
+	StatusPass          TestStatus = "pass"
+	StatusFail          TestStatus = "fail"
+	StatusNotApplicable TestStatus = "notapplicable"
+	StatusError         TestStatus = "error"
+	StatusSkipped       TestStatus = "skipped"
+)
+
 // The result of evaluation of a test. There can be more then one
 // EvaluationResult present in the results of a test, if the source
 // information returned more than one matching object.
 type evaluationResult struct {
-	criteria evaluationCriteria // Criteria used during evaluation.
-	result   bool               // The result of the evaluation.
+	criteria   evaluationCriteria // Criteria used during evaluation.
+	result     bool               // The result of the evaluation.
+	evaluator  string             // The name of the evaluator used.
+	expression string             // Description of the comparison that was made.
 }
 
 // Generic criteria for an evaluation. A source object should always support
@@ -70,14 +119,18 @@ type evaluationResult struct {
 //
 // An identifier is used to track the source of an evaluation. For example,
 // this may be a filename or a package name. In those examples, the testValue
-// may be matched content from the file, or a package version string.
+// may be matched content from the file, or a package version string. Where the
+// source is a file, line may be set to the line number the test data was
+// obtained from.
 type evaluationCriteria struct {
 	identifier string // The identifier used to track the source.
 	testValue  string // the actual test data passed to the evaluator.
+	line       int    // Line number in the source file, 0 if not applicable.
+	pkgtype    string // Package type if the source is a package, e.g. dpkg.
 }
 
 type genericEvaluator interface {
-	evaluate(evaluationCriteria) (evaluationResult, error)
+	evaluate(*Document, evaluationCriteria) (evaluationResult, error)
 }
 
 func (t *Test) validate(d *Document) error {
@@ -87,6 +140,10 @@ func (t *Test) validate(d *Document) error {
 	if t.getEvaluationInterface() == nil {
 		return fmt.Errorf("%v: no valid evaluation interface", t.TestID)
 	}
+	err := t.Evaluator.validate()
+	if err != nil {
+		return fmt.Errorf("%v: %v", t.TestID, err)
+	}
 	for _, x := range t.If {
 		ptr, err := d.GetTest(x)
 		if err != nil {
@@ -96,6 +153,27 @@ func (t *Test) validate(d *Document) error {
 			return fmt.Errorf("%v: test cannot reference itself", t.TestID)
 		}
 	}
+	if t.Depends != nil {
+		err := t.Depends.validate(d, t)
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	switch t.Match {
+	case "", MatchAny, MatchAll, MatchNone:
+		if t.MinCount != 0 || t.MaxCount != 0 {
+			return fmt.Errorf("%v: mincount and maxcount require match count", t.TestID)
+		}
+	case MatchCount:
+		if t.MinCount < 0 || t.MaxCount < 0 {
+			return fmt.Errorf("%v: mincount and maxcount cannot be negative", t.TestID)
+		}
+		if t.MaxCount > 0 && t.MaxCount < t.MinCount {
+			return fmt.Errorf("%v: maxcount cannot be less than mincount", t.TestID)
+		}
+	default:
+		return fmt.Errorf("%v: invalid match mode %v", t.TestID, t.Match)
+	}
 	// Ensure the tags only contain valid characters
 	for _, x := range t.Tags {
 		if strings.ContainsRune(x.Key, '"') {
@@ -109,12 +187,9 @@ func (t *Test) validate(d *Document) error {
 }
 
 func (t *Test) getEvaluationInterface() genericEvaluator {
-	if t.EVR.Value != "" {
-		return &t.EVR
-	} else if t.Regexp.Value != "" {
-		return &t.Regexp
-	} else if t.EMatch.Value != "" {
-		return &t.EMatch
+	ev := t.Evaluator.getEvaluationInterface()
+	if ev != nil {
+		return ev
 	}
 	// If no evaluation criteria exists, use a no op evaluator
 	// which will always return true for the test if any source objects
@@ -123,7 +198,8 @@ func (t *Test) getEvaluationInterface() genericEvaluator {
 }
 
 func (t *Test) errorHandler(d *Document) error {
-	if sRuntime.excall == nil {
+	e := d.getEngine()
+	if e.excall == nil {
 		return t.err
 	}
 	if !t.ExpectError {
@@ -131,11 +207,58 @@ func (t *Test) errorHandler(d *Document) error {
 		if err != nil {
 			panic("GetResults() in errorHandler")
 		}
-		sRuntime.excall(tr)
+		e.excall(tr)
 	}
 	return t.err
 }
 
+// clone returns a copy of the test with no evaluation state.
+func (t *Test) clone() Test {
+	ret := *t
+	ret.prepared = false
+	ret.evaluated = false
+	ret.err = nil
+	ret.masterResult = false
+	ret.hasTrueResults = false
+	ret.results = nil
+	ret.status = ""
+	ret.evalTime = 0
+	return ret
+}
+
+// dependencies returns the identifiers of all tests the test depends on, both
+// from If and the dependency expression.
+func (t *Test) dependencies() []string {
+	ret := make([]string, 0)
+	ret = append(ret, t.If...)
+	if t.Depends != nil {
+		ret = append(ret, t.Depends.tests()...)
+	}
+	return ret
+}
+
+// matchResults rolls up the results of the test according to the match mode.
+func (t *Test) matchResults() bool {
+	cnt := 0
+	for _, x := range t.results {
+		if x.result {
+			cnt++
+		}
+	}
+	switch t.Match {
+	case MatchAll:
+		return len(t.results) > 0 && cnt == len(t.results)
+	case MatchNone:
+		return cnt == 0
+	case MatchCount:
+		if cnt < t.MinCount {
+			return false
+		}
+		return t.MaxCount == 0 || cnt <= t.MaxCount
+	}
+	return cnt > 0
+}
+
 func (t *Test) runTest(d *Document) error {
 	if t.evaluated {
 		return nil
@@ -146,7 +269,8 @@ func (t *Test) runTest(d *Document) error {
 		return t.err
 	}
 
-	debugPrint("runTest(): running \"%v\"\n", t.TestID)
+	e := d.getEngine()
+	d.debugPrint("runTest(): running \"%v\"\n", t.TestID)
 	t.evaluated = true
 	// First, see if this test has any dependencies. If so, run those
 	// before we execute this one.
@@ -162,7 +286,24 @@ func (t *Test) runTest(d *Document) error {
 			return t.errorHandler(d)
 		}
 	}
+	// An error in a test referenced by the dependency expression is
+	// handled when the expression is evaluated, since it only matters if
+	// it decides the result.
+	if t.Depends != nil {
+		for _, x := range t.Depends.tests() {
+			dt, err := d.GetTest(x)
+			if err != nil {
+				t.err = err
+				return t.errorHandler(d)
+			}
+			dt.runTest(d)
+		}
+	}
 
+	start := time.Now()
+	defer func() {
+		t.evalTime = time.Since(start)
+	}()
 	ev := t.getEvaluationInterface()
 	if ev == nil {
 		t.err = fmt.Errorf("test has no valid evaluation interface")
@@ -178,13 +319,21 @@ func (t *Test) runTest(d *Document) error {
 		t.err = fmt.Errorf("object not prepared")
 		return t.errorHandler(d)
 	}
+	if d.Options.WarningsAsErrors {
+		obj, _ := d.getObject(t.Object)
+		if len(obj.warnings) > 0 {
+			t.err = fmt.Errorf("%v warning(s) during object preparation, first was %v: %v",
+				len(obj.warnings), obj.warnings[0].path, obj.warnings[0].err)
+			return t.errorHandler(d)
+		}
+	}
 	si, _ := d.getObjectInterface(t.Object)
 	if si == nil {
 		t.err = fmt.Errorf("test has no valid source interface")
 		return t.errorHandler(d)
 	}
-	for _, x := range si.getCriteria() {
-		res, err := ev.evaluate(x)
+	for _, x := range si.getCriteria(d) {
+		res, err := ev.evaluate(d, x)
 		if err != nil {
 			t.err = err
 			return t.errorHandler(d)
@@ -194,17 +343,22 @@ func (t *Test) runTest(d *Document) error {
 
 	// Set the master result for the test. If any of the dependent tests
 	// are false from a master result perspective, this one is also false.
-	// If at least one result for this test is true, the master result for
-	// the test is true.
+	// Otherwise the results for this test are rolled up based on the
+	// match mode.
 	t.hasTrueResults = false
 	for _, x := range t.results {
 		if x.result {
 			t.hasTrueResults = true
 		}
 	}
-	t.masterResult = false
-	if t.hasTrueResults {
-		t.masterResult = true
+	t.masterResult = t.matchResults()
+	// If the object returned no candidates and the match mode did not
+	// produce a true result, the test does not apply to this system.
+	t.status = StatusFail
+	if t.masterResult {
+		t.status = StatusPass
+	} else if len(t.results) == 0 {
+		t.status = StatusNotApplicable
 	}
 	for _, x := range t.If {
 		dt, err := d.GetTest(x)
@@ -215,20 +369,33 @@ func (t *Test) runTest(d *Document) error {
 		}
 		if !dt.masterResult {
 			t.masterResult = false
+			t.status = StatusSkipped
 			break
 		}
 	}
+	if t.Depends != nil {
+		met, err := t.Depends.evaluate(d)
+		if err != nil {
+			t.err = err
+			t.masterResult = false
+			return t.errorHandler(d)
+		}
+		if !met {
+			t.masterResult = false
+			t.status = StatusSkipped
+		}
+	}
 
 	// See if there is a test expected result handler installed, if so
 	// validate it and call the handler if required.
-	if sRuntime.excall != nil {
+	if e.excall != nil {
 		if (t.masterResult != t.ExpectedResult) ||
 			t.ExpectError {
 			tr, err := GetResults(d, t.TestID)
 			if err != nil {
 				panic("GetResults() in expected handler")
 			}
-			sRuntime.excall(tr)
+			e.excall(tr)
 		}
 	}
 
@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"time"
+)
+
+// objectStats records the cost of preparing an object.
+type objectStats struct {
+	prepare      time.Duration // Time spent preparing the object and firing import chains.
+	packageCache time.Duration // Time spent waiting for the package cache.
+	filesWalked  int           // Number of files examined while locating files.
+	filesRead    int           // Number of files whose content was examined.
+}
+
+// fileIndexStats records the file system activity of an analysis.
+type fileIndexStats struct {
+	walks       int // Directory trees walked.
+	filesWalked int // Files found while walking directory trees.
+	filesRead   int // Files read from disk.
+	cacheHits   int // File reads satisfied from the index.
+}
+
+// ObjectTiming describes the cost of preparing an object during analysis.
+// FilesWalked is the number of files that were examined while locating files
+// for the object, and FilesRead the number of files whose content was
+// examined; these include files that were served from the file index shared
+// by all objects. PackageCache is the time spent waiting for the package cache
+// to be available, which includes building it if this object needed it first.
+type ObjectTiming struct {
+	Object       string        `json:"object" yaml:"object"`
+	Prepare      time.Duration `json:"prepare" yaml:"prepare"`
+	PackageCache time.Duration `json:"packagecache,omitempty" yaml:"packagecache,omitempty"`
+	FilesWalked  int           `json:"fileswalked" yaml:"fileswalked"`
+	FilesRead    int           `json:"filesread" yaml:"filesread"`
+}
+
+// TestTiming describes the cost of a test. Evaluation is the time spent
+// evaluating the test, excluding any tests it depends on, and Object describes
+// the cost of preparing the object the test references.
+type TestTiming struct {
+	TestID     string        `json:"testid" yaml:"testid"`
+	Evaluation time.Duration `json:"evaluation" yaml:"evaluation"`
+	Object     ObjectTiming  `json:"object" yaml:"object"`
+}
+
+// AnalysisSummary summarizes the cost of analyzing a document.
+//
+// Walks is the number of directory trees walked and FilesWalked the number
+// of files found during those walks. FilesRead is the number of files read
+// from disk, and FileCacheHits the number of times a file was examined using
+// content already held in the file index. PackageCache is the longest time
+// any object waited for the package cache.
+type AnalysisSummary struct {
+	Duration      time.Duration  `json:"duration" yaml:"duration"`
+	Preparation   time.Duration  `json:"preparation" yaml:"preparation"`
+	Evaluation    time.Duration  `json:"evaluation" yaml:"evaluation"`
+	PackageCache  time.Duration  `json:"packagecache" yaml:"packagecache"`
+	Walks         int            `json:"walks" yaml:"walks"`
+	FilesWalked   int            `json:"fileswalked" yaml:"fileswalked"`
+	FilesRead     int            `json:"filesread" yaml:"filesread"`
+	FileCacheHits int            `json:"filecachehits" yaml:"filecachehits"`
+	Objects       []ObjectTiming `json:"objects" yaml:"objects"`
+	Tests         []TestTiming   `json:"tests" yaml:"tests"`
+}
+
+func (o *Object) timing() ObjectTiming {
+	return ObjectTiming{
+		Object:       o.Object,
+		Prepare:      o.stats.prepare,
+		PackageCache: o.stats.packageCache,
+		FilesWalked:  o.stats.filesWalked,
+		FilesRead:    o.stats.filesRead,
+	}
+}
+
+func (t *Test) timing(d *Document) TestTiming {
+	ret := TestTiming{TestID: t.TestID, Evaluation: t.evalTime}
+	obj, err := d.getObject(t.Object)
+	if err == nil {
+		ret.Object = obj.timing()
+	}
+	return ret
+}
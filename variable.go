@@ -18,13 +18,13 @@ type Variable struct {
 	Value string `json:"value" yaml:"value"`
 }
 
-func variableExpansion(v []Variable, in string) string {
+func variableExpansion(d *Document, v []Variable, in string) string {
 	res := in
 	for _, x := range v {
 		s := "\\$\\{" + x.Key + "\\}"
 		re := regexp.MustCompile(s)
 		res = re.ReplaceAllLiteralString(res, x.Value)
 	}
-	debugPrint("variableExpansion(): %v -> %v\n", in, res)
+	d.debugPrint("variableExpansion(): %v -> %v\n", in, res)
 	return res
 }